@@ -0,0 +1,344 @@
+package gosock
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	adminKickReason    = "Kicked by admin"
+	adminHealthTimeout = 2 * time.Second
+)
+
+// Decides whether a request may use the admin API
+type AdminAuthorizer func(r *http.Request) bool
+
+type AdminConnection struct {
+	Id          string    `json:"id"`
+	RemoteAddr  string    `json:"remoteAddr"`
+	Identity    *Identity `json:"identity,omitempty"`
+	UserId      string    `json:"userId,omitempty"`
+	Channels    []string  `json:"channels"`
+	ConnectedAt time.Time `json:"connectedAt"`
+	BytesIn     uint64    `json:"bytesIn"`
+	BytesOut    uint64    `json:"bytesOut"`
+}
+
+type AdminChannel struct {
+	Path         string `json:"path"`
+	LocalMembers int    `json:"localMembers"`
+	Members      int    `json:"members"`
+}
+
+type AdminRouter struct {
+	Pattern  string         `json:"pattern"`
+	Channels []AdminChannel `json:"channels"`
+}
+
+type AdminStats struct {
+	NodeId      string         `json:"nodeId"`
+	Namespace   string         `json:"namespace"`
+	Connections int            `json:"connections"`
+	Channels    int            `json:"channels"`
+	Pool        PoolStats      `json:"pool"`
+	RateLimited RateLimitStats `json:"rateLimited"`
+	// ok, unknown if the producer manager can not report its health, or the
+	// error it returned
+	Producer string `json:"producer"`
+}
+
+type adminKick struct {
+	// Only removes the connection from this channel when set
+	Channel string    `json:"channel"`
+	Code    CloseCode `json:"code"`
+	Reason  string    `json:"reason"`
+}
+
+type adminEmit struct {
+	Channel string          `json:"channel"`
+	Event   string          `json:"event"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+type adminHandler struct {
+	hub       *Hub
+	authorize AdminAuthorizer
+}
+
+// Returns an http.Handler exposing the hub's live state and admin actions.
+// Every request must pass authorize. A nil authorize rejects everything.
+// Mount it under a prefix with http.StripPrefix.
+//
+//	GET  /stats                  pool, rate limit and producer stats
+//	GET  /connections            every connection on this node
+//	GET  /connections/{id}       a single connection
+//	POST /connections/{id}/kick  close a connection or remove it from a channel
+//	GET  /channels               open channels per router with member counts
+//	POST /emit                   emit an event to a channel
+func (h *Hub) AdminHandler(authorize AdminAuthorizer) http.Handler {
+	return &adminHandler{
+		hub:       h,
+		authorize: authorize,
+	}
+}
+
+func (a *adminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if a.authorize == nil || !a.authorize(r) {
+		writeAdminError(w, http.StatusUnauthorized, ErrUnauthenticated)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	switch {
+	case len(parts) == 1 && (parts[0] == "" || parts[0] == "stats"):
+		a.get(w, r, a.stats)
+
+	case len(parts) == 1 && parts[0] == "connections":
+		a.get(w, r, a.connections)
+
+	case len(parts) == 2 && parts[0] == "connections":
+		a.get(w, r, func(r *http.Request) (interface{}, error) {
+			return a.connection(parts[1])
+		})
+
+	case len(parts) == 3 && parts[0] == "connections" && parts[2] == "kick":
+		a.post(w, r, func(r *http.Request) (interface{}, error) {
+			return nil, a.kick(r, parts[1])
+		})
+
+	case len(parts) == 1 && parts[0] == "channels":
+		a.get(w, r, a.channels)
+
+	case len(parts) == 1 && parts[0] == "emit":
+		a.post(w, r, func(r *http.Request) (interface{}, error) {
+			return nil, a.emit(r)
+		})
+
+	default:
+		writeAdminError(w, http.StatusNotFound, errors.New("Not found"))
+	}
+}
+
+func (a *adminHandler) get(w http.ResponseWriter, r *http.Request, fn func(*http.Request) (interface{}, error)) {
+	a.handle(w, r, http.MethodGet, fn)
+}
+
+func (a *adminHandler) post(w http.ResponseWriter, r *http.Request, fn func(*http.Request) (interface{}, error)) {
+	a.handle(w, r, http.MethodPost, fn)
+}
+
+func (a *adminHandler) handle(w http.ResponseWriter, r *http.Request, method string, fn func(*http.Request) (interface{}, error)) {
+	if r.Method != method {
+		w.Header().Set("Allow", method)
+		writeAdminError(w, http.StatusMethodNotAllowed, errors.New("Method not allowed"))
+		return
+	}
+
+	result, err := fn(r)
+
+	switch {
+	case errors.Is(err, ErrConnectionNotFound), errors.Is(err, ErrChannelNotFound):
+		writeAdminError(w, http.StatusNotFound, err)
+	case err != nil:
+		writeAdminError(w, http.StatusBadRequest, err)
+	case result == nil:
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeAdminJSON(w, http.StatusOK, result)
+	}
+}
+
+func (a *adminHandler) stats(r *http.Request) (interface{}, error) {
+	h := a.hub
+
+	h.RLock()
+	connections := len(h.conns)
+	h.RUnlock()
+
+	stats := AdminStats{
+		NodeId:      h.NodeId(),
+		Namespace:   h.Namespace(),
+		Connections: connections,
+		Channels:    len(h.registry.list(nil)),
+		Pool:        h.pool.Stats(),
+		RateLimited: h.RateLimitStats(),
+		Producer:    "unknown",
+	}
+
+	if checker, ok := h.producerManager.(HealthChecker); ok {
+		ctx, cancel := context.WithTimeout(r.Context(), adminHealthTimeout)
+		defer cancel()
+
+		stats.Producer = "ok"
+
+		if err := checker.Health(ctx); err != nil {
+			stats.Producer = err.Error()
+		}
+	}
+
+	return stats, nil
+}
+
+func (a *adminHandler) connections(r *http.Request) (interface{}, error) {
+	a.hub.RLock()
+	conns := make([]*Conn, 0, len(a.hub.conns))
+
+	for conn := range a.hub.conns {
+		conns = append(conns, conn)
+	}
+	a.hub.RUnlock()
+
+	sort.Slice(conns, func(i, j int) bool {
+		return conns[i].Id < conns[j].Id
+	})
+
+	result := make([]AdminConnection, 0, len(conns))
+
+	for _, conn := range conns {
+		result = append(result, adminConnection(conn))
+	}
+
+	return result, nil
+}
+
+func (a *adminHandler) connection(id string) (interface{}, error) {
+	conn, err := a.hub.findConn(id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return adminConnection(conn), nil
+}
+
+func adminConnection(conn *Conn) AdminConnection {
+	return AdminConnection{
+		Id:          conn.Id,
+		RemoteAddr:  conn.RemoteAddr().String(),
+		Identity:    conn.Identity(),
+		UserId:      conn.UserId(),
+		Channels:    conn.Channels(),
+		ConnectedAt: conn.ConnectedAt(),
+		BytesIn:     conn.BytesIn(),
+		BytesOut:    conn.BytesOut(),
+	}
+}
+
+func (a *adminHandler) channels(r *http.Request) (interface{}, error) {
+	routers := a.hub.channels.Routers()
+
+	sort.Slice(routers, func(i, j int) bool {
+		return routers[i].Pattern() < routers[j].Pattern()
+	})
+
+	result := make([]AdminRouter, 0, len(routers))
+
+	for _, router := range routers {
+		channels := []AdminChannel{}
+
+		for _, channel := range router.Channels() {
+			channels = append(channels, AdminChannel{
+				Path:         channel.Path(),
+				LocalMembers: channel.LocalMemberCount(),
+				Members:      channel.MemberCount(),
+			})
+		}
+
+		result = append(result, AdminRouter{
+			Pattern:  router.Pattern(),
+			Channels: channels,
+		})
+	}
+
+	return result, nil
+}
+
+func (a *adminHandler) kick(r *http.Request, id string) error {
+	conn, err := a.hub.findConn(id)
+
+	if err != nil {
+		return err
+	}
+
+	var body adminKick
+
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			return err
+		}
+	}
+
+	if body.Reason == "" {
+		body.Reason = adminKickReason
+	}
+
+	if body.Channel != "" {
+		channel, err := a.channel(body.Channel)
+
+		if err != nil {
+			return err
+		}
+
+		defer a.hub.registry.release(channel)
+
+		channel.Kick(conn, body.Reason)
+		return nil
+	}
+
+	if body.Code == 0 {
+		body.Code = ClosePolicyViolation
+	}
+
+	return conn.Close(body.Code, body.Reason)
+}
+
+func (a *adminHandler) emit(r *http.Request) error {
+	var body adminEmit
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		return err
+	}
+
+	if body.Channel == "" || body.Event == "" {
+		return errors.New("Channel and event are required")
+	}
+
+	channel, err := a.channel(body.Channel)
+
+	if err != nil {
+		return err
+	}
+
+	defer a.hub.registry.release(channel)
+
+	return channel.Emit(r.Context(), body.Event, body.Payload)
+}
+
+// Returns an open channel with a reference that must be released. Admin
+// requests never create channels.
+func (a *adminHandler) channel(path string) (*Channel, error) {
+	channel, ok := a.hub.registry.acquireOpen(path)
+
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrChannelNotFound, path)
+	}
+
+	return channel, nil
+}
+
+func writeAdminJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeAdminError(w http.ResponseWriter, status int, err error) {
+	writeAdminJSON(w, status, J{"error": err.Error()})
+}
@@ -0,0 +1,147 @@
+package gosock
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gobwas/ws"
+)
+
+func adminRequest(t *testing.T, handler http.Handler, method string, path string, body string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	r.Header.Set("X-Admin", "secret")
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	return w
+}
+
+func TestAdminAuthorize(t *testing.T) {
+	hub := makeHub()
+
+	tests := []struct {
+		authorize AdminAuthorizer
+		want      int
+	}{
+		{nil, http.StatusUnauthorized},
+		{func(r *http.Request) bool { return false }, http.StatusUnauthorized},
+		{func(r *http.Request) bool { return r.Header.Get("X-Admin") == "secret" }, http.StatusOK},
+	}
+
+	for _, test := range tests {
+		w := adminRequest(t, hub.AdminHandler(test.authorize), http.MethodGet, "/stats", "")
+
+		if w.Code != test.want {
+			t.Errorf("Expected status %d. Got %d", test.want, w.Code)
+		}
+	}
+}
+
+func TestAdminConnections(t *testing.T) {
+	conn, client := makeTestConn(t)
+	hub := conn.hub
+	hub.addConn(conn)
+
+	handler := hub.AdminHandler(func(r *http.Request) bool { return true })
+
+	w := adminRequest(t, handler, http.MethodGet, "/connections", "")
+
+	var conns []AdminConnection
+
+	if err := json.Unmarshal(w.Body.Bytes(), &conns); err != nil {
+		t.Fatalf("Could not decode connections: %s", err)
+	}
+
+	if len(conns) != 1 || conns[0].Id != conn.Id {
+		t.Errorf("Expected connection %s. Got %+v", conn.Id, conns)
+	}
+
+	if w := adminRequest(t, handler, http.MethodGet, "/connections/missing", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for unknown connection. Got %d", w.Code)
+	}
+
+	hub.Channel("chat.{id}", func(r *Router) {})
+
+	// Kicking from a channel that is not open does not create it
+	if w := adminRequest(t, handler, http.MethodPost, "/connections/"+conn.Id+"/kick", `{"channel":"chat.1"}`); w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for kick from unopened channel. Got %d %s", w.Code, w.Body)
+	}
+
+	if _, err := hub.Lookup("chat.1"); err == nil {
+		t.Errorf("Kick should not open chat.1")
+	}
+
+	if w := adminRequest(t, handler, http.MethodGet, "/connections/"+conn.Id+"/kick", ""); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for GET kick. Got %d", w.Code)
+	}
+
+	done := make(chan *httptest.ResponseRecorder)
+
+	go func() {
+		done <- adminRequest(t, handler, http.MethodPost, "/connections/"+conn.Id+"/kick", `{"reason":"bye"}`)
+	}()
+
+	frame, err := ws.ReadFrame(client)
+
+	if err != nil {
+		t.Fatalf("Should receive close frame: %s", err)
+	}
+
+	code, reason := ws.ParseCloseFrameData(frame.Payload)
+
+	if code != ws.StatusPolicyViolation || reason != "bye" {
+		t.Errorf("Expected close %d bye. Got %d %s", ws.StatusPolicyViolation, code, reason)
+	}
+
+	if w := <-done; w.Code != http.StatusNoContent {
+		t.Errorf("Expected 204 from kick. Got %d %s", w.Code, w.Body)
+	}
+}
+
+func TestAdminChannelsAndEmit(t *testing.T) {
+	hub := makeHub()
+	hub.Channel("chat.{id}", func(r *Router) {})
+
+	channel, _ := hub.registry.acquire("chat.1")
+	defer hub.registry.release(channel)
+
+	handler := hub.AdminHandler(func(r *http.Request) bool { return true })
+
+	w := adminRequest(t, handler, http.MethodGet, "/channels", "")
+
+	var routers []AdminRouter
+
+	if err := json.Unmarshal(w.Body.Bytes(), &routers); err != nil {
+		t.Fatalf("Could not decode channels: %s", err)
+	}
+
+	if len(routers) != 1 || len(routers[0].Channels) != 1 || routers[0].Channels[0].Path != "chat.1" {
+		t.Errorf("Expected chat.1 under chat.{id}. Got %+v", routers)
+	}
+
+	emits := []struct {
+		body string
+		want int
+	}{
+		{`{"channel":"chat.1","event":"notice","payload":{"text":"hi"}}`, http.StatusNoContent},
+		{`{"channel":"room.1","event":"notice"}`, http.StatusNotFound},
+		{`{"channel":"chat.2","event":"notice"}`, http.StatusNotFound},
+		{`{"channel":"chat.1"}`, http.StatusBadRequest},
+	}
+
+	for _, emit := range emits {
+		if w := adminRequest(t, handler, http.MethodPost, "/emit", emit.body); w.Code != emit.want {
+			t.Errorf("Emit %s should return %d. Got %d %s", emit.body, emit.want, w.Code, w.Body)
+		}
+	}
+
+	if _, err := hub.Lookup("chat.2"); err == nil {
+		t.Errorf("Emit should not open chat.2")
+	}
+}
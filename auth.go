@@ -0,0 +1,250 @@
+package gosock
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	defaultAuthQueryParam = "token"
+	defaultAuthTimeout    = time.Second * 10
+)
+
+var (
+	ErrUnauthenticated    = errors.New("Authentication required")
+	ErrInvalidCredentials = errors.New("Invalid credentials")
+	ErrCredentialsExpired = errors.New("Credentials expired")
+	ErrIdentityMismatch   = errors.New("Credentials belong to a different user")
+)
+
+// Who a connection belongs to
+type Identity struct {
+	UserId string `json:"userId"`
+	// Zero if the credentials never expire
+	ExpiresAt time.Time              `json:"expiresAt"`
+	Claims    map[string]interface{} `json:"claims,omitempty"`
+	// Time the connection stays open past ExpiresAt. Set by the
+	// authenticator to match the leeway it allowed when verifying.
+	Leeway time.Duration `json:"-"`
+}
+
+// Verifies a token and returns the identity it belongs to
+type Authenticator interface {
+	Authenticate(ctx context.Context, token string) (*Identity, error)
+}
+
+// Lets a function be used as an Authenticator
+type AuthenticatorFunc func(ctx context.Context, token string) (*Identity, error)
+
+func (f AuthenticatorFunc) Authenticate(ctx context.Context, token string) (*Identity, error) {
+	return f(ctx, token)
+}
+
+type AuthOption func(*authConfig)
+
+type authConfig struct {
+	authenticator Authenticator
+	queryParam    string
+	subprotocol   string
+	timeout       time.Duration
+}
+
+// Query string param the token is read from at upgrade. Defaults to "token".
+func AuthQueryParam(name string) AuthOption {
+	return func(config *authConfig) {
+		config.queryParam = name
+	}
+}
+
+// Reads the token from the Sec-WebSocket-Protocol header. Browsers can not
+// set headers on upgrades so the client offers two protocols, name followed
+// by the token, and the server selects name.
+//
+//	new WebSocket(url, ["access_token", token])
+func AuthSubprotocol(name string) AuthOption {
+	return func(config *authConfig) {
+		config.subprotocol = name
+	}
+}
+
+// How long a connection that did not send a token at upgrade has to send an
+// __auth__ event before it is closed. Defaults to 10 seconds.
+func AuthTimeout(timeout time.Duration) AuthOption {
+	return func(config *authConfig) {
+		config.timeout = timeout
+	}
+}
+
+// Requires every connection to authenticate. Tokens are read from the query
+// string or subprotocol at upgrade, or from an __auth__ event sent as the
+// first message. Clients can refresh their credentials with a __reauth__
+// event and are disconnected when their credentials expire.
+//
+// Messages other than __auth__ from unauthenticated connections are
+// rejected.
+func (h *Hub) Authenticate(authenticator Authenticator, options ...AuthOption) {
+	config := &authConfig{
+		authenticator: authenticator,
+		queryParam:    defaultAuthQueryParam,
+		timeout:       defaultAuthTimeout,
+	}
+
+	for _, option := range options {
+		option(config)
+	}
+
+	h.Lock()
+	defer h.Unlock()
+
+	h.auth = config
+}
+
+// Identity the connection authenticated as. Nil until authenticated.
+func (c *Conn) Identity() *Identity {
+	c.RLock()
+	defer c.RUnlock()
+
+	return c.identity
+}
+
+func (c *Conn) Authenticated() bool {
+	return c.Identity() != nil
+}
+
+// Finds the token in an upgrade request
+func (config *authConfig) upgradeToken(r *http.Request) string {
+	if config.queryParam != "" {
+		if token := r.URL.Query().Get(config.queryParam); token != "" {
+			return token
+		}
+	}
+
+	if config.subprotocol == "" {
+		return ""
+	}
+
+	var protocols []string
+
+	for _, header := range r.Header.Values("Sec-WebSocket-Protocol") {
+		for _, protocol := range strings.Split(header, ",") {
+			protocols = append(protocols, strings.TrimSpace(protocol))
+		}
+	}
+
+	for i, protocol := range protocols {
+		if protocol == config.subprotocol && i+1 < len(protocols) {
+			return protocols[i+1]
+		}
+	}
+
+	return ""
+}
+
+// Sets the connection's identity and schedules it to be closed when the
+// credentials expire, allowing for the identity's leeway
+func (c *Conn) authenticate(identity *Identity) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.identity = identity
+	c.userId = identity.UserId
+
+	if c.authTimer != nil {
+		c.authTimer.Stop()
+		c.authTimer = nil
+	}
+
+	if identity.ExpiresAt.IsZero() {
+		return
+	}
+
+	c.authTimer = time.AfterFunc(time.Until(identity.ExpiresAt.Add(identity.Leeway)), func() {
+		log.Printf("Credentials for connection %s expired", c.Id)
+		c.Close(ClosePolicyViolation, ErrCredentialsExpired.Error())
+	})
+}
+
+// Closes connections that have not authenticated within the timeout
+func (c *Conn) requireAuth(timeout time.Duration) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.authTimer = time.AfterFunc(timeout, func() {
+		if !c.Authenticated() {
+			c.Close(ClosePolicyViolation, ErrUnauthenticated.Error())
+		}
+	})
+}
+
+func (c *Conn) stopAuthTimer() {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.authTimer != nil {
+		c.authTimer.Stop()
+	}
+}
+
+type authPayload struct {
+	Token string `json:"token"`
+}
+
+func (h *Hub) handleAuth(conn *Conn, msg *Message) {
+	if h.auth == nil {
+		return
+	}
+
+	var payload authPayload
+	err := msg.BindPayload(&payload)
+
+	var identity *Identity
+
+	if err == nil {
+		identity, err = h.auth.authenticator.Authenticate(conn.Context(), payload.Token)
+	}
+
+	if err == nil && identity == nil {
+		err = ErrInvalidCredentials
+	}
+
+	// Memberships were authorized for the current user so credentials can
+	// only be refreshed, not swapped for another user's
+	if current := conn.Identity(); err == nil && current != nil && current.UserId != identity.UserId {
+		err = ErrIdentityMismatch
+	}
+
+	if err != nil {
+		conn.sendResponse(&Response{
+			Event:   AuthFailedEventName,
+			Payload: J{"error": err.Error()},
+		})
+
+		// A failed refresh keeps the current credentials until they expire
+		if msg.Event == AuthEventName && !conn.Authenticated() {
+			conn.Close(ClosePolicyViolation, ErrInvalidCredentials.Error())
+		}
+
+		return
+	}
+
+	conn.authenticate(identity)
+
+	conn.sendResponse(&Response{
+		Event:   AuthenticatedEventName,
+		Payload: identity,
+	})
+}
+
+func GetIdentity(ctx context.Context) *Identity {
+	conn := GetConnection(ctx)
+
+	if conn == nil {
+		return nil
+	}
+
+	return conn.Identity()
+}
@@ -0,0 +1,174 @@
+package gosock
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsutil"
+)
+
+func TestUpgradeToken(t *testing.T) {
+	config := &authConfig{
+		queryParam:  defaultAuthQueryParam,
+		subprotocol: "access_token",
+	}
+
+	tests := []struct {
+		name      string
+		url       string
+		protocols string
+		want      string
+	}{
+		{"query", "/?token=abc", "", "abc"},
+		{"subprotocol", "/", "access_token, abc", "abc"},
+		{"subprotocol without token", "/", "access_token", ""},
+		{"none", "/", "chat", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tt.url, nil)
+
+			if tt.protocols != "" {
+				r.Header.Set("Sec-WebSocket-Protocol", tt.protocols)
+			}
+
+			if got := config.upgradeToken(r); got != tt.want {
+				t.Errorf("got %q, wanted %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// Accepts tokens of the form user:ttl such as alice:1h
+var testAuthenticator = AuthenticatorFunc(func(ctx context.Context, token string) (*Identity, error) {
+	var user, ttl string
+
+	for i := range token {
+		if token[i] == ':' {
+			user, ttl = token[:i], token[i+1:]
+		}
+	}
+
+	d, err := time.ParseDuration(ttl)
+
+	if user == "" || err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	return &Identity{UserId: user, ExpiresAt: time.Now().Add(d)}, nil
+})
+
+func makeAuthConn(t *testing.T) (*Conn, net.Conn) {
+	t.Helper()
+
+	conn, client := makeTestConn(t)
+	conn.hub.Authenticate(testAuthenticator)
+
+	return conn, client
+}
+
+func readTestResponse(t *testing.T, client net.Conn) *Response {
+	t.Helper()
+
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	data, err := wsutil.ReadServerText(client)
+
+	if err != nil {
+		t.Fatalf("Expected a response. Got %s", err)
+	}
+
+	response, err := ResponseFromBytes(data)
+
+	if err != nil {
+		t.Fatalf("Could not decode response: %s", err)
+	}
+
+	return response
+}
+
+func authMessage(event string, token string) *Message {
+	payload, _ := json.Marshal(authPayload{Token: token})
+
+	return &Message{Event: event, Payload: payload}
+}
+
+func TestUnauthenticatedMessageRejected(t *testing.T) {
+	conn, client := makeAuthConn(t)
+
+	go conn.hub.handleMessage(conn, &Message{Channel: "chat.1", Event: "chat"})
+
+	response := readTestResponse(t, client)
+	payload, _ := response.Payload.(map[string]interface{})
+
+	if response.Event != ErrorEventName || payload["error"] != ErrUnauthenticated.Error() {
+		t.Errorf("Expected %s error. Got %s %v", ErrUnauthenticated, response.Event, response.Payload)
+	}
+}
+
+func TestReauth(t *testing.T) {
+	conn, client := makeAuthConn(t)
+	conn.authenticate(&Identity{UserId: "alice", ExpiresAt: time.Now().Add(time.Minute)})
+
+	go conn.hub.handleMessage(conn, authMessage(ReauthEventName, "alice:1h"))
+
+	if response := readTestResponse(t, client); response.Event != AuthenticatedEventName {
+		t.Fatalf("Expected %s. Got %s %v", AuthenticatedEventName, response.Event, response.Payload)
+	}
+
+	if until := time.Until(conn.Identity().ExpiresAt); until < 30*time.Minute {
+		t.Errorf("Reauth should refresh the expiry. Expires in %s", until)
+	}
+
+	go conn.hub.handleMessage(conn, authMessage(ReauthEventName, "mallory:1h"))
+
+	if response := readTestResponse(t, client); response.Event != AuthFailedEventName {
+		t.Errorf("Reauth as another user should fail. Got %s", response.Event)
+	}
+
+	if conn.UserId() != "alice" {
+		t.Errorf("Identity should not change after a failed reauth. Got %s", conn.UserId())
+	}
+}
+
+func TestDisconnectOnExpiry(t *testing.T) {
+	conn, client := makeAuthConn(t)
+	conn.authenticate(&Identity{UserId: "alice", ExpiresAt: time.Now().Add(20 * time.Millisecond)})
+
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	frame, err := ws.ReadFrame(client)
+
+	if err != nil {
+		t.Fatalf("Should receive close frame: %s", err)
+	}
+
+	code, reason := ws.ParseCloseFrameData(frame.Payload)
+
+	if code != ws.StatusPolicyViolation || reason != ErrCredentialsExpired.Error() {
+		t.Errorf("Expected close %d %s. Got %d %s", ws.StatusPolicyViolation, ErrCredentialsExpired, code, reason)
+	}
+}
+
+func TestExpiryLeeway(t *testing.T) {
+	conn, client := makeAuthConn(t)
+	conn.authenticate(&Identity{UserId: "alice", ExpiresAt: time.Now(), Leeway: 100 * time.Millisecond})
+
+	// Nothing is sent until the leeway has passed
+	client.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+
+	if _, err := ws.ReadFrame(client); err == nil {
+		t.Errorf("Connection should stay open during the leeway")
+	}
+
+	client.SetReadDeadline(time.Now().Add(time.Second))
+
+	if _, err := ws.ReadFrame(client); err != nil {
+		t.Errorf("Connection should close after the leeway. Got %s", err)
+	}
+}
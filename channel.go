@@ -4,7 +4,9 @@ import (
 	"context"
 	"errors"
 	"log"
+	"runtime/debug"
 	"sync"
+	"time"
 )
 
 // Used to compare if two connections are the same
@@ -26,22 +28,69 @@ type Channel struct {
 	send   chan *ChannelMessage
 
 	conns map[*Conn]bool
+	// State for each member that lives from join to leave
+	states map[*Conn]*State
 
 	compareConnections ConnComparator
 
 	producer Producer
 
-	wg sync.WaitGroup
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+
+	// Limits events from all members combined
+	limiter *tokenBucket
+
+	// Values that live as long as the channel, such as room state loaded by
+	// the router's OnCreate hook
+	state *State
+	// Closed once the OnCreate hook has finished
+	ready chan struct{}
+	// Error returned by the OnCreate hook. Set before ready is closed.
+	createErr error
+	// Closes the channel when the router's grace period passes without
+	// members
+	closeTimer *time.Timer
+	// Set once the channel stops accepting messages
+	closed bool
+
+	// References held by local members and messages being handled. Guarded
+	// by the hub's registry.
+	refs int
+	// Set when the registry removes the channel. Guarded by the registry.
+	removed bool
 }
 
 func (c *Channel) Path() string {
 	return c.path
 }
 
+// Identifies the channel across namespaces. Shared backends such as
+// producers and the membership registry should use this instead of Path so
+// the same path in two namespaces does not collide.
+func (c *Channel) Key() string {
+	if c.hub.namespace == "" {
+		return c.path
+	}
+
+	return c.hub.namespace + "/" + c.path
+}
+
+// Values stored for the lifetime of the channel
+func (c *Channel) State() *State {
+	return c.state
+}
+
 func (c *Channel) Params() *Params {
 	return c.params
 }
 
+// Context for handlers run on behalf of conn, holding the connection and the
+// channel's params
+func (c *Channel) handlerContext(conn *Conn) context.Context {
+	return withParams(withConnection(conn.Context(), conn), c.params)
+}
+
 func (c *Channel) Param(key string) (string, bool) {
 	if c.params == nil {
 		return "", false
@@ -50,6 +99,36 @@ func (c *Channel) Param(key string) (string, bool) {
 	return c.params.Get(key)
 }
 
+// Number of members of this channel across every node in the cluster. Falls
+// back to the local member count if the membership registry is unavailable.
+func (c *Channel) MemberCount() int {
+	count, err := c.hub.getMembership().Count(context.Background(), c.Key())
+
+	if err != nil {
+		log.Printf("Error counting members of channel %s: %s", c.path, err)
+		return c.LocalMemberCount()
+	}
+
+	return count
+}
+
+// State for a member of the channel. It is created when the connection
+// joins and discarded when it leaves. Returns nil if conn is not a member.
+func (c *Channel) ConnState(conn *Conn) *State {
+	c.RLock()
+	defer c.RUnlock()
+
+	return c.states[conn]
+}
+
+// Number of members of this channel connected to this node
+func (c *Channel) LocalMemberCount() int {
+	c.RLock()
+	defer c.RUnlock()
+
+	return len(c.conns)
+}
+
 func newChannel(path string, params *Params, router *Router) *Channel {
 	channel := &Channel{
 		path:   path,
@@ -59,13 +138,17 @@ func newChannel(path string, params *Params, router *Router) *Channel {
 
 		hub: router.hub,
 
-		conns: make(map[*Conn]bool),
+		conns:  make(map[*Conn]bool),
+		states: make(map[*Conn]*State),
+		state:  NewState(),
+		ready:  make(chan struct{}),
 
 		compareConnections: defaultConnComparator,
 	}
 
-	channel.producer = channel.hub.producerManager.Create(channel)
-	channel.producer.Subscribe()
+	if router.channelLimit != nil {
+		channel.limiter = newTokenBucket(*router.channelLimit)
+	}
 
 	return channel
 }
@@ -102,7 +185,7 @@ func (c *Channel) Reply(ctx context.Context, event string, payload interface{})
 }
 
 func (c *Channel) ReplyErr(ctx context.Context, err error) {
-	c.Reply(ctx, "error", J{
+	c.Reply(ctx, ErrorEventName, J{
 		"error": err.Error(),
 	})
 }
@@ -138,17 +221,134 @@ func (c *Channel) Write(msg *ChannelMessage) {
 }
 
 func (c *Channel) sendMsg(msg *ChannelMessage) {
+	c.RLock()
+
+	if c.closed {
+		c.RUnlock()
+		log.Printf("Dropping message sent to closed channel %s", c.path)
+		return
+	}
+
 	c.wg.Add(1)
+	c.RUnlock()
+
 	c.send <- msg
 }
 
 func (c *Channel) close() {
-	c.wg.Wait()
-	close(c.send)
+	c.closeOnce.Do(func() {
+		<-c.ready
+
+		// Messages already being sent are delivered before the writer stops
+		c.Lock()
+		c.closed = true
+		c.Unlock()
+
+		c.wg.Wait()
+		close(c.send)
+
+		c.producer.Stop()
 
-	c.producer.Stop()
+		c.runHook(closeEventName, c.router.onClose)
+	})
+}
+
+// Subscribes the producer, runs the router's OnCreate hook and lets callers
+// waiting on ready use the channel. A channel whose hook fails is discarded
+// without running OnClose.
+func (c *Channel) create() error {
+	defer close(c.ready)
+
+	c.hub.RLock()
+	manager := c.hub.producerManager
+	c.hub.RUnlock()
+
+	// Subscribing may reach out over the network so it is done here rather
+	// than in newChannel, which runs under the registry lock
+	c.producer = manager.Create(c)
+	c.producer.Subscribe()
+
+	c.createErr = c.runHook(createEventName, c.router.onCreate)
+
+	if c.createErr != nil {
+		c.closeOnce.Do(func() {
+			c.Lock()
+			c.closed = true
+			c.Unlock()
+
+			close(c.send)
+			c.producer.Stop()
+		})
+	}
 
-	c.router.removeChannel(c.path)
+	return c.createErr
+}
+
+func (c *Channel) runHook(event string, hook EventHandler) (err error) {
+	if hook == nil {
+		return nil
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			c.hub.pool.reportPanic(&PanicReport{
+				Value:   r,
+				Stack:   debug.Stack(),
+				Channel: c.path,
+				Event:   event,
+			})
+
+			err = ErrInternal
+		}
+	}()
+
+	ctx := withParams(context.Background(), c.params)
+
+	if err = hook(ctx, c); err != nil {
+		log.Printf("Error running %s hook for channel %s: %s", event, c.path, err)
+	}
+
+	return err
+}
+
+// Closes the channel if it has no members on any node. With a grace period
+// set on the router the channel is closed once the period passes, unless a
+// member joins first.
+func (c *Channel) closeIfEmpty() {
+	grace := c.router.closeGrace
+
+	if grace <= 0 {
+		go c.tryClose()
+		return
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	// Already waiting to close
+	if c.closeTimer != nil {
+		return
+	}
+
+	c.closeTimer = time.AfterFunc(grace, func() {
+		c.Lock()
+		c.closeTimer = nil
+		c.Unlock()
+
+		c.tryClose()
+	})
+}
+
+// Closes the channel unless something on this node references it or other
+// nodes still have members
+func (c *Channel) tryClose() {
+	if c.MemberCount() > 0 {
+		return
+	}
+
+	if c.hub.registry.remove(c) {
+		c.close()
+	}
 }
 
 /**
@@ -163,30 +363,35 @@ func (c *Channel) writer() {
 		msgPayload, _ := msg.Response.Encode()
 		msgConn := msg.conn
 
+		// Waiting on a full pool is bounded by the receiving connection so a
+		// dead member can not stall the writer
 		if msg.Type == replyType && msgConn != nil {
-			c.hub.pool.Schedule(func() {
+			c.hub.pool.schedule(msgConn.Context(), func() {
 				msgConn.sendRaw(msgPayload)
 			})
 			continue
 		}
 
+		// Copy the members so joins and leaves can happen while sending
 		c.RLock()
-		conns := c.conns
-		c.RUnlock()
+		conns := make([]*Conn, 0, len(c.conns))
 
-	connWalk:
-		for conn, ok := range conns {
-			if !ok {
-				continue connWalk
+		for conn, ok := range c.conns {
+			if ok {
+				conns = append(conns, conn)
 			}
+		}
+		c.RUnlock()
 
+	connWalk:
+		for _, conn := range conns {
 			if msg.Type == broadcastType && msgConn != nil && c.compareConnections(conn, msgConn) {
 				continue connWalk
 			}
 
 			// For closure
 			sendConn := conn
-			c.hub.pool.Schedule(func() {
+			c.hub.pool.schedule(sendConn.Context(), func() {
 				sendConn.sendRaw(msgPayload)
 			})
 		}
@@ -201,33 +406,84 @@ func (c *Channel) handleJoin(ctx context.Context, msg *Message) {
 		return
 	}
 
-	joinHandler, hasJoin := c.router.routerHandlers[joinEventName]
-
-	if !hasJoin {
+	if _, hasJoin := c.router.lifecycleHandler(JoinEventName); !hasJoin {
 		log.Printf("Channel %s has no join handler", c.router.path)
 		return
 	}
 
-	beforeJoin, hasBeforeJoin := c.router.routerHandlers[beforeJoinEventName]
-
 	ctx = withMessage(ctx, msg)
 
-	if hasBeforeJoin {
-		err := beforeJoin(ctx, c)
+	if err := c.join(ctx, conn); err != nil {
+		c.ReplyErr(ctx, err)
+	}
+}
 
-		if err != nil {
-			c.ReplyErr(ctx, err)
-			return
+// Runs the before join handler, adds the connection and then runs the join
+// handler
+func (c *Channel) join(ctx context.Context, conn *Conn) error {
+	beforeJoin, hasBeforeJoin := c.router.lifecycleHandler(beforeJoinEventName)
+
+	if hasBeforeJoin {
+		if err := beforeJoin(ctx, c); err != nil {
+			return err
 		}
 	}
 
-	c.addConnection(conn)
+	if err := c.addConnection(conn); err != nil {
+		return err
+	}
 
-	err := joinHandler(ctx, c)
+	joinHandler, hasJoin := c.router.lifecycleHandler(JoinEventName)
 
-	if err != nil {
-		c.ReplyErr(ctx, err)
+	if !hasJoin {
+		return nil
 	}
+
+	return joinHandler(ctx, c)
+}
+
+// Subscribes a connection to the channel from server code. The router's
+// before join and join handlers run as usual and the client is sent a
+// __joined__ event. Returns the before join handler's error if it rejects
+// the connection.
+func (c *Channel) AddConn(conn *Conn) error {
+	if c.hasConn(conn) {
+		return nil
+	}
+
+	ctx := c.handlerContext(conn)
+
+	if err := c.join(ctx, conn); err != nil {
+		return err
+	}
+
+	conn.sendResponse(&Response{
+		Channel: c.path,
+		Event:   JoinedEventName,
+	})
+
+	return nil
+}
+
+// Removes a member from the channel. The client is sent a __kicked__ event
+// with the reason and the router's leave handler runs as if the client had
+// left.
+func (c *Channel) Kick(conn *Conn, reason string) {
+	if !c.hasConn(conn) {
+		return
+	}
+
+	conn.sendResponse(&Response{
+		Channel: c.path,
+		Event:   KickedEventName,
+		Payload: J{"reason": reason},
+	})
+
+	if leaveHandler, hasLeave := c.router.lifecycleHandler(LeaveEventName); hasLeave {
+		leaveHandler(c.handlerContext(conn), c)
+	}
+
+	c.removeConnection(conn)
 }
 
 func (c *Channel) handleLeave(ctx context.Context, msg *Message) {
@@ -238,48 +494,87 @@ func (c *Channel) handleLeave(ctx context.Context, msg *Message) {
 		return
 	}
 
-	leavehandler, hasLeave := c.router.routerHandlers[leaveEventName]
+	leavehandler, hasLeave := c.router.lifecycleHandler(LeaveEventName)
 
 	if hasLeave {
-		ctx := withMessage(conn.ctx, msg)
+		ctx := withMessage(conn.Context(), msg)
 		leavehandler(ctx, c)
 	}
 
 	c.removeConnection(conn)
 }
 
+// Removes a disconnected member and schedules the router's disconnect handler
 func (c *Channel) handleDisconnect(conn *Conn) {
+	// Removing the member is never left to the pool, which may drop tasks
 	c.removeConnection(conn)
 
-	handler, ok := c.router.routerHandlers[disconnectEventName]
+	handler, ok := c.router.lifecycleHandler(disconnectEventName)
 
-	if ok {
-		handler(conn.ctx, c)
+	if !ok {
+		return
 	}
+
+	c.hub.pool.Schedule(func() {
+		defer c.hub.recoverLifecycle(conn, c, disconnectEventName)
+
+		// The connection's context is already cancelled but the handler may
+		// still need to clean up
+		handler(context.WithoutCancel(c.handlerContext(conn)), c)
+	})
 }
 
-func (c *Channel) addConnection(conn *Conn) {
+// Adds a member, which keeps the channel open until it is removed. Fails if
+// the channel has closed.
+func (c *Channel) addConnection(conn *Conn) error {
 	c.Lock()
-	defer c.Unlock()
 
-	c.conns[conn] = true
+	if !c.conns[conn] {
+		if err := c.hub.registry.retain(c); err != nil {
+			c.Unlock()
+			return err
+		}
+
+		c.conns[conn] = true
+	}
+
+	if c.closeTimer != nil {
+		c.closeTimer.Stop()
+		c.closeTimer = nil
+	}
+
+	if _, ok := c.states[conn]; !ok {
+		c.states[conn] = NewState()
+	}
+	c.Unlock()
+
 	conn.addChannel(c)
+
+	if err := c.hub.getMembership().Add(context.Background(), c.hub.nodeId, c.Key(), conn.Id); err != nil {
+		log.Printf("Error adding member %s to channel %s: %s", conn.Id, c.path, err)
+	}
+
+	return nil
 }
 
 func (c *Channel) removeConnection(conn *Conn) {
 	c.Lock()
-	defer c.Unlock()
-
+	member := c.conns[conn]
 	delete(c.conns, conn)
+	delete(c.states, conn)
+	c.Unlock()
+
 	conn.removeChannel(c)
 
-	if (len(c.conns)) == 0 {
-		go c.close()
+	if err := c.hub.getMembership().Remove(context.Background(), c.hub.nodeId, c.Key(), conn.Id); err != nil {
+		log.Printf("Error removing member %s from channel %s: %s", conn.Id, c.path, err)
 	}
 
-	// if len(c.conns) == 0 {
-	// 	c.close()
-	// }
+	// Other nodes may still have members. The hub's heartbeat will close
+	// this channel once they are gone.
+	if member {
+		c.hub.registry.release(c)
+	}
 }
 
 func (c *Channel) hasConn(conn *Conn) bool {
@@ -0,0 +1,357 @@
+package gosock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestChannelLifecycleHooks(t *testing.T) {
+	conn, _ := makeTestConn(t)
+	hub := conn.hub
+
+	closed := make(chan string, 1)
+
+	hub.Channel("room.{id}", func(r *Router) {
+		r.OnCreate(func(ctx context.Context, c *Channel) error {
+			id, _ := Param(ctx, "id")
+			c.State().Set("loaded", id)
+			return nil
+		})
+
+		r.OnClose(func(ctx context.Context, c *Channel) error {
+			loaded, _ := c.State().Get("loaded")
+			closed <- loaded.(string)
+			return nil
+		})
+
+		r.CloseGrace(10 * time.Millisecond)
+	})
+
+	if _, err := hub.Lookup("room.5"); !errors.Is(err, ErrChannelNotFound) {
+		t.Fatalf("Lookup should not create channels. Got %v", err)
+	}
+
+	channel, err := hub.registry.acquire("room.5")
+
+	if err != nil {
+		t.Fatalf("Channel room.5 should open: %s", err)
+	}
+
+	if loaded, _ := channel.State().Get("loaded"); loaded != "5" {
+		t.Errorf("OnCreate should run before the channel is returned. Got %v", loaded)
+	}
+
+	channel.addConnection(conn)
+	hub.registry.release(channel)
+
+	channel.removeConnection(conn)
+
+	select {
+	case id := <-closed:
+		if id != "5" {
+			t.Errorf("OnClose should see state for room 5. Got %s", id)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Channel should close after the grace period")
+	}
+
+	if _, err := hub.Lookup("room.5"); !errors.Is(err, ErrChannelNotFound) {
+		t.Errorf("Lookup after close should not find the channel. Got %v", err)
+	}
+}
+
+func TestChannelAddConnAndKick(t *testing.T) {
+	conn, client := makeTestConn(t)
+	hub := conn.hub
+
+	calls := make(chan string, 3)
+
+	hub.Channel("room.{id}", func(r *Router) {
+		r.On(
+			r.BeforeJoin(func(ctx context.Context, c *Channel) error {
+				id, _ := Param(ctx, "id")
+				calls <- "before join " + id
+				return nil
+			}),
+			r.Join(func(ctx context.Context, c *Channel) error {
+				id, _ := Param(ctx, "id")
+				calls <- "join " + id
+				return nil
+			}),
+			r.Leave(func(ctx context.Context, c *Channel) error {
+				id, _ := Param(ctx, "id")
+				calls <- "leave " + id
+				return nil
+			}),
+		)
+	})
+
+	joined := make(chan error, 1)
+	var channel *Channel
+
+	go func() {
+		var err error
+		channel, err = hub.Join(conn, "room.1")
+		joined <- err
+	}()
+
+	if response := readTestResponse(t, client); response.Event != JoinedEventName || response.Channel != "room.1" {
+		t.Errorf("Expected %s on room.1. Got %s on %s", JoinedEventName, response.Event, response.Channel)
+	}
+
+	if err := <-joined; err != nil {
+		t.Fatalf("Join failed: %s", err)
+	}
+
+	if !channel.hasConn(conn) {
+		t.Fatalf("Connection should be a member after joining")
+	}
+
+	// Server side joins and kicks see the channel's params
+	for _, want := range []string{"before join 1", "join 1"} {
+		if got := <-calls; got != want {
+			t.Errorf("Expected %s handler. Got %s", want, got)
+		}
+	}
+
+	go channel.Kick(conn, "spamming")
+
+	response := readTestResponse(t, client)
+	payload, _ := response.Payload.(map[string]interface{})
+
+	if response.Event != KickedEventName || payload["reason"] != "spamming" {
+		t.Errorf("Expected %s with reason. Got %s %v", KickedEventName, response.Event, response.Payload)
+	}
+
+	select {
+	case got := <-calls:
+		if got != "leave 1" {
+			t.Errorf("Expected leave handler. Got %s", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Kick should run the leave handler")
+	}
+
+	waitForChannels(t, hub, 0)
+
+	if channel.hasConn(conn) {
+		t.Errorf("Kicked connection should not be a member")
+	}
+}
+
+func TestJoinUser(t *testing.T) {
+	hub := makeHub()
+	hub.Start()
+
+	errBlocked := errors.New("Blocked")
+
+	hub.Channel("user.{id}", func(r *Router) {
+		r.On(r.BeforeJoin(func(ctx context.Context, c *Channel) error {
+			if GetConnection(ctx).Id == "blocked" {
+				return errBlocked
+			}
+			return nil
+		}))
+	})
+
+	expires := time.Now().Add(time.Hour)
+	conns := []*Conn{}
+
+	for _, id := range []string{"blocked", "first", "second"} {
+		conn := makeDrainedConn(t, hub, id)
+		conn.authenticate(&Identity{UserId: "alice", ExpiresAt: expires})
+		hub.addConn(conn)
+		conns = append(conns, conn)
+	}
+
+	err := hub.JoinUser("alice", "user.alice")
+
+	if !errors.Is(err, errBlocked) {
+		t.Errorf("Expected the before join error. Got %v", err)
+	}
+
+	channel, err := hub.Lookup("user.alice")
+
+	if err != nil {
+		t.Fatalf("Channel should be open: %s", err)
+	}
+
+	for _, conn := range conns {
+		if member := channel.hasConn(conn); member != (conn.Id != "blocked") {
+			t.Errorf("Unexpected membership for %s. Got %t", conn.Id, member)
+		}
+	}
+}
+
+// Reports whether the channel is waiting out its grace period
+func pendingClose(c *Channel) bool {
+	c.RLock()
+	defer c.RUnlock()
+
+	return c.closeTimer != nil
+}
+
+func TestJoinDuringGraceCancelsClose(t *testing.T) {
+	hub := makeHub()
+	hub.Start()
+
+	var closes atomic.Int32
+
+	hub.Channel("room.{id}", func(r *Router) {
+		r.On(r.Join(func(ctx context.Context, c *Channel) error { return nil }))
+		r.OnClose(func(ctx context.Context, c *Channel) error {
+			closes.Add(1)
+			return nil
+		})
+		// Long enough that the timer never fires during the test
+		r.CloseGrace(time.Minute)
+	})
+
+	conn := makeDrainedConn(t, hub, "member")
+
+	channel, err := hub.Join(conn, "room.1")
+
+	if err != nil {
+		t.Fatalf("Join failed: %s", err)
+	}
+
+	channel.removeConnection(conn)
+
+	if !pendingClose(channel) {
+		t.Fatalf("Empty channel should wait out its grace period")
+	}
+
+	if again, err := hub.Join(conn, "room.1"); err != nil || again != channel {
+		t.Fatalf("Join during the grace period should reuse the channel. Got %v", err)
+	}
+
+	if pendingClose(channel) {
+		t.Errorf("Join during the grace period should cancel the close")
+	}
+
+	if closes.Load() != 0 {
+		t.Errorf("Channel should not have closed")
+	}
+
+	waitForChannels(t, hub, 1)
+}
+
+// Members leave concurrently with and without a grace period. Run with -race.
+func TestOnCloseRunsOnce(t *testing.T) {
+	for _, grace := range []time.Duration{0, 10 * time.Millisecond} {
+		hub := makeHub()
+		hub.Start()
+
+		var closes atomic.Int32
+		closed := make(chan struct{}, 10)
+
+		hub.Channel("room.{id}", func(r *Router) {
+			r.On(r.Join(func(ctx context.Context, c *Channel) error { return nil }))
+			r.OnClose(func(ctx context.Context, c *Channel) error {
+				closes.Add(1)
+				closed <- struct{}{}
+				return nil
+			})
+			r.CloseGrace(grace)
+		})
+
+		var channel *Channel
+		conns := make([]*Conn, 10)
+
+		for i := range conns {
+			conns[i] = makeDrainedConn(t, hub, fmt.Sprintf("conn-%d", i))
+			channel, _ = hub.Join(conns[i], "room.1")
+		}
+
+		var wg sync.WaitGroup
+
+		for _, conn := range conns {
+			wg.Add(1)
+
+			go func(conn *Conn) {
+				defer wg.Done()
+				channel.removeConnection(conn)
+			}(conn)
+		}
+
+		wg.Wait()
+
+		select {
+		case <-closed:
+		case <-time.After(time.Second):
+			t.Fatalf("Channel should close once its members leave with grace %s", grace)
+		}
+
+		waitForChannels(t, hub, 0)
+
+		// Later attempts to close the channel do nothing
+		channel.tryClose()
+		channel.close()
+
+		if closes.Load() != 1 {
+			t.Errorf("OnClose should run once with grace %s. Ran %d times", grace, closes.Load())
+		}
+	}
+}
+
+func TestOnCreateErrorFailsJoin(t *testing.T) {
+	conn, client := makeTestConn(t)
+	hub := conn.hub
+
+	errLoad := errors.New("Could not load room")
+
+	var fail atomic.Bool
+	var closes atomic.Int32
+
+	fail.Store(true)
+
+	hub.Channel("room.{id}", func(r *Router) {
+		r.On(r.Join(func(ctx context.Context, c *Channel) error { return nil }))
+		r.OnCreate(func(ctx context.Context, c *Channel) error {
+			if fail.Load() {
+				return errLoad
+			}
+			return nil
+		})
+		r.OnClose(func(ctx context.Context, c *Channel) error {
+			closes.Add(1)
+			return nil
+		})
+	})
+
+	if _, err := hub.Join(conn, "room.1"); !errors.Is(err, errLoad) {
+		t.Errorf("Join should return the OnCreate error. Got %v", err)
+	}
+
+	if _, err := hub.Lookup("room.1"); err == nil {
+		t.Errorf("Channel should be discarded when OnCreate fails")
+	}
+
+	// Clients joining are sent the error
+	go hub.handleMessage(conn, &Message{Channel: "room.1", Event: JoinEventName})
+
+	response := readTestResponse(t, client)
+	payload, _ := response.Payload.(map[string]interface{})
+
+	if response.Event != ErrorEventName || payload["error"] != errLoad.Error() {
+		t.Errorf("Expected %s error. Got %s %v", errLoad, response.Event, response.Payload)
+	}
+
+	if closes.Load() != 0 {
+		t.Errorf("OnClose should not run for a channel that was never created")
+	}
+
+	// The next join tries to create the channel again
+	fail.Store(false)
+
+	go hub.Join(conn, "room.1")
+
+	if response := readTestResponse(t, client); response.Event != JoinedEventName {
+		t.Errorf("Join should succeed once OnCreate does. Got %s %v", response.Event, response.Payload)
+	}
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/colevoss/gosock"
+	"github.com/colevoss/gosock/internal/wsclient"
+	"github.com/gobwas/ws"
+)
+
+// How long to wait for the server to read the close frame
+const closeTimeout = time.Second
+
+type benchConfig struct {
+	url      string
+	conns    int
+	paths    []string
+	joins    int
+	event    string
+	rate     float64
+	duration time.Duration
+	warmup   time.Duration
+	drain    time.Duration
+}
+
+// Sent as the payload of every event so responses can be matched to the
+// connection and message that caused them
+type benchPayload struct {
+	Conn   int   `json:"conn"`
+	Seq    int64 `json:"seq"`
+	SentAt int64 `json:"sentAt"`
+}
+
+type benchMessage struct {
+	Channel string          `json:"channel"`
+	Event   string          `json:"event"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+type counters struct {
+	connected  atomic.Int64
+	connErrors atomic.Int64
+	sent       atomic.Int64
+	sendErrors atomic.Int64
+	// Responses to this connection's own messages
+	echoed atomic.Int64
+	// Every response received, including other connections' messages
+	received atomic.Int64
+	errors   atomic.Int64
+}
+
+type client struct {
+	id     int
+	conn   *wsclient.Conn
+	config *benchConfig
+	stats  *counters
+
+	mu        sync.Mutex
+	latencies []time.Duration
+}
+
+func run(ctx context.Context, config benchConfig) *report {
+	stats := &counters{}
+	clients := make([]*client, config.conns)
+	connectTimes := make([]time.Duration, config.conns)
+
+	var wg sync.WaitGroup
+
+	start := time.Now()
+
+	for i := 0; i < config.conns; i++ {
+		i := i
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			c, elapsed, err := dial(ctx, i, &config, stats)
+
+			if err != nil {
+				log.Printf("Connection %d failed: %s", i, err)
+				stats.connErrors.Add(1)
+				return
+			}
+
+			clients[i] = c
+			connectTimes[i] = elapsed
+			stats.connected.Add(1)
+		}()
+	}
+
+	wg.Wait()
+	connectElapsed := time.Since(start)
+
+	var readers sync.WaitGroup
+
+	for _, c := range clients {
+		if c == nil {
+			continue
+		}
+
+		c := c
+		readers.Add(1)
+
+		go func() {
+			defer readers.Done()
+			c.read()
+		}()
+
+		c.join()
+	}
+
+	sleep(ctx, config.warmup)
+
+	sendCtx, cancel := context.WithTimeout(ctx, config.duration)
+	defer cancel()
+
+	sendStart := time.Now()
+
+	for _, c := range clients {
+		if c == nil {
+			continue
+		}
+
+		c := c
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+			c.send(sendCtx)
+		}()
+	}
+
+	wg.Wait()
+	sendElapsed := time.Since(sendStart)
+
+	sleep(ctx, config.drain)
+
+	for _, c := range clients {
+		if c != nil {
+			c.conn.Close(closeTimeout)
+		}
+	}
+
+	readers.Wait()
+
+	r := &report{
+		connections:    config.conns,
+		connected:      stats.connected.Load(),
+		connErrors:     stats.connErrors.Load(),
+		connectElapsed: connectElapsed,
+		sendElapsed:    sendElapsed,
+		sent:           stats.sent.Load(),
+		sendErrors:     stats.sendErrors.Load(),
+		echoed:         stats.echoed.Load(),
+		received:       stats.received.Load(),
+		errors:         stats.errors.Load(),
+	}
+
+	for i, c := range clients {
+		if c == nil {
+			continue
+		}
+
+		r.connectTimes = append(r.connectTimes, connectTimes[i])
+		r.latencies = append(r.latencies, c.latencies...)
+	}
+
+	return r
+}
+
+// Connects and waits for the server's welcome message
+func dial(ctx context.Context, id int, config *benchConfig, stats *counters) (*client, time.Duration, error) {
+	start := time.Now()
+
+	conn, br, _, err := ws.Dial(ctx, config.url)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	c := &client{
+		id:     id,
+		conn:   wsclient.New(conn, br),
+		config: config,
+		stats:  stats,
+	}
+
+	for {
+		data, err := c.conn.Read()
+
+		if err != nil {
+			conn.Close()
+			return nil, 0, err
+		}
+
+		response, err := gosock.ResponseFromBytes(data)
+
+		if err == nil && response.Event == gosock.ConnectedEventName {
+			return c, time.Since(start), nil
+		}
+	}
+}
+
+// Joins the client's share of channels, spreading connections evenly across
+// all of them
+func (c *client) join() {
+	for i := 0; i < c.config.joins; i++ {
+		path := c.path(i)
+
+		if err := c.write(&benchMessage{Channel: path, Event: gosock.JoinEventName}); err != nil {
+			log.Printf("Connection %d failed to join %s: %s", c.id, path, err)
+		}
+	}
+}
+
+func (c *client) path(i int) string {
+	paths := c.config.paths
+	return paths[(c.id*c.config.joins+i)%len(paths)]
+}
+
+// Sends events round robin to the client's channels at the configured rate
+// until ctx is done
+func (c *client) send(ctx context.Context) {
+	if c.config.rate <= 0 {
+		return
+	}
+
+	interval := time.Duration(float64(time.Second) / c.config.rate)
+
+	// Stagger connections so they do not all send at once
+	sleep(ctx, time.Duration(c.id%100)*interval/100)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var seq int64
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		payload, _ := json.Marshal(benchPayload{
+			Conn:   c.id,
+			Seq:    seq,
+			SentAt: time.Now().UnixNano(),
+		})
+
+		msg := &benchMessage{
+			Channel: c.path(int(seq) % c.config.joins),
+			Event:   c.config.event,
+			Payload: payload,
+		}
+
+		seq++
+
+		if err := c.write(msg); err != nil {
+			c.stats.sendErrors.Add(1)
+			log.Printf("Connection %d failed to send: %s", c.id, err)
+			return
+		}
+
+		c.stats.sent.Add(1)
+	}
+}
+
+func (c *client) read() {
+	for {
+		data, err := c.conn.Read()
+
+		if err != nil {
+			return
+		}
+
+		now := time.Now()
+		c.stats.received.Add(1)
+
+		var response struct {
+			Event   string          `json:"event"`
+			Payload json.RawMessage `json:"payload"`
+		}
+
+		if err := json.Unmarshal(data, &response); err != nil {
+			continue
+		}
+
+		switch response.Event {
+		case gosock.ErrorEventName, gosock.RateLimitedEventName:
+			c.stats.errors.Add(1)
+			log.Printf("Connection %d received %s: %s", c.id, response.Event, response.Payload)
+			continue
+		}
+
+		if response.Event != c.config.event {
+			continue
+		}
+
+		var payload benchPayload
+
+		if err := json.Unmarshal(response.Payload, &payload); err != nil || payload.Conn != c.id {
+			continue
+		}
+
+		c.stats.echoed.Add(1)
+
+		c.mu.Lock()
+		c.latencies = append(c.latencies, now.Sub(time.Unix(0, payload.SentAt)))
+		c.mu.Unlock()
+	}
+}
+
+func (c *client) write(msg *benchMessage) error {
+	data, err := json.Marshal(msg)
+
+	if err != nil {
+		return err
+	}
+
+	return c.conn.WriteText(data)
+}
+
+func sleep(ctx context.Context, d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+	case <-t.C:
+	}
+}
@@ -0,0 +1,91 @@
+// Command gosock-bench load tests a gosock server. It opens many connections,
+// joins channels, sends events at a target rate and reports connection time,
+// latency percentiles, throughput and drops.
+//
+// The event handler must send the event's payload back to the sender, with
+// Channel.Reply or Channel.Emit, for latency and drops to be measured. Pass
+// -serve to benchmark a built-in echo server instead of a remote one.
+//
+//	gosock-bench -url ws://localhost:8080 -conns 500 -channels 'chat.{1..1000}' -rate 5
+//	gosock-bench -serve :9090 -conns 1000 -joins 3
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+)
+
+var (
+	url      = flag.String("url", "ws://localhost:8080", "Server to connect to")
+	serve    = flag.String("serve", "", "Start a built-in echo server on this address and benchmark it")
+	conns    = flag.Int("conns", 100, "Number of concurrent connections")
+	channels = flag.String("channels", "chat.{1..100}", "Channels to join. {a..b} expands to every number in the range")
+	joins    = flag.Int("joins", 1, "Channels each connection joins")
+	event    = flag.String("event", "chat", "Event to send")
+	rate     = flag.Float64("rate", 10, "Messages per second sent by each connection")
+	duration = flag.Duration("duration", 10*time.Second, "How long to send messages")
+	warmup   = flag.Duration("warmup", time.Second, "Time to wait after joining before sending")
+	drain    = flag.Duration("drain", 2*time.Second, "Time to wait for responses after sending stops")
+	verbose  = flag.Bool("v", false, "Log server and connection errors")
+)
+
+func main() {
+	flag.Parse()
+
+	if !*verbose {
+		log.SetOutput(io.Discard)
+	}
+
+	paths, err := expandPattern(*channels)
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	target := *url
+
+	if *serve != "" {
+		addr, err := startEchoServer(*serve, *channels, *event)
+
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		target = "ws://" + addr
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	config := benchConfig{
+		url:      target,
+		conns:    *conns,
+		paths:    paths,
+		joins:    *joins,
+		event:    *event,
+		rate:     *rate,
+		duration: *duration,
+		warmup:   *warmup,
+		drain:    *drain,
+	}
+
+	fmt.Printf(
+		"Benchmarking %s with %d connections, %d channels each, %.1f msg/s per connection for %s\n",
+		target,
+		config.conns,
+		config.joins,
+		config.rate,
+		config.duration,
+	)
+
+	report := run(ctx, config)
+	report.print(os.Stdout)
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+var rangePattern = regexp.MustCompile(`\{(\d+)\.\.(\d+)\}`)
+
+// Expands every {a..b} range in pattern into one path per number. Patterns
+// without ranges expand to themselves.
+func expandPattern(pattern string) ([]string, error) {
+	match := rangePattern.FindStringSubmatchIndex(pattern)
+
+	if match == nil {
+		return []string{pattern}, nil
+	}
+
+	from, _ := strconv.Atoi(pattern[match[2]:match[3]])
+	to, _ := strconv.Atoi(pattern[match[4]:match[5]])
+
+	if from > to {
+		return nil, fmt.Errorf("Invalid range %s", pattern[match[0]:match[1]])
+	}
+
+	var paths []string
+
+	for i := from; i <= to; i++ {
+		rest, err := expandPattern(pattern[match[1]:])
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, suffix := range rest {
+			paths = append(paths, pattern[:match[0]]+strconv.Itoa(i)+suffix)
+		}
+	}
+
+	return paths, nil
+}
+
+// Replaces ranges with params so the pattern can be registered as a route
+func routePattern(pattern string) string {
+	i := 0
+
+	return rangePattern.ReplaceAllStringFunc(pattern, func(string) string {
+		i++
+		return fmt.Sprintf("{p%d}", i)
+	})
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestExpandPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{"chat", []string{"chat"}},
+		{"chat.{1..3}", []string{"chat.1", "chat.2", "chat.3"}},
+		{"room.{1..2}.{5..6}", []string{"room.1.5", "room.1.6", "room.2.5", "room.2.6"}},
+	}
+
+	for _, test := range tests {
+		got, err := expandPattern(test.pattern)
+
+		if err != nil {
+			t.Errorf("%s should expand. Got %s", test.pattern, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s should expand to %v. Got %v", test.pattern, test.want, got)
+		}
+	}
+
+	if _, err := expandPattern("chat.{3..1}"); err == nil {
+		t.Errorf("Descending range should be invalid")
+	}
+}
+
+func TestRoutePattern(t *testing.T) {
+	if got := routePattern("room.{1..2}.{5..6}"); got != "room.{p1}.{p2}" {
+		t.Errorf("Expected room.{p1}.{p2}. Got %s", got)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	var sorted []time.Duration
+
+	for i := 1; i <= 100; i++ {
+		sorted = append(sorted, time.Duration(i)*time.Millisecond)
+	}
+
+	tests := map[float64]time.Duration{
+		50:  50 * time.Millisecond,
+		90:  90 * time.Millisecond,
+		99:  99 * time.Millisecond,
+		100: 100 * time.Millisecond,
+	}
+
+	for p, want := range tests {
+		if got := percentile(sorted, p); got != want {
+			t.Errorf("p%.0f should be %s. Got %s", p, want, got)
+		}
+	}
+}
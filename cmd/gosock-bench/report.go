@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+type report struct {
+	connections    int
+	connected      int64
+	connErrors     int64
+	connectElapsed time.Duration
+	connectTimes   []time.Duration
+
+	sendElapsed time.Duration
+	sent        int64
+	sendErrors  int64
+	echoed      int64
+	received    int64
+	errors      int64
+	latencies   []time.Duration
+}
+
+// Messages sent that never came back to the sender
+func (r *report) dropped() int64 {
+	if r.echoed > r.sent {
+		return 0
+	}
+
+	return r.sent - r.echoed
+}
+
+func (r *report) print(w io.Writer) {
+	fmt.Fprintf(w, "\nConnections\n")
+	fmt.Fprintf(w, "  connected  %d/%d in %s (%d failed)\n", r.connected, r.connections, round(r.connectElapsed), r.connErrors)
+	printPercentiles(w, r.connectTimes)
+
+	fmt.Fprintf(w, "\nMessages\n")
+	fmt.Fprintf(w, "  sent       %d (%.1f/s, %d failed)\n", r.sent, perSecond(r.sent, r.sendElapsed), r.sendErrors)
+	fmt.Fprintf(w, "  received   %d (%.1f/s)\n", r.received, perSecond(r.received, r.sendElapsed))
+	fmt.Fprintf(w, "  echoed     %d\n", r.echoed)
+	fmt.Fprintf(w, "  dropped    %d (%.2f%%)\n", r.dropped(), percent(r.dropped(), r.sent))
+	fmt.Fprintf(w, "  errors     %d\n", r.errors)
+
+	fmt.Fprintf(w, "\nLatency\n")
+	printPercentiles(w, r.latencies)
+}
+
+func printPercentiles(w io.Writer, durations []time.Duration) {
+	if len(durations) == 0 {
+		fmt.Fprintf(w, "  no samples\n")
+		return
+	}
+
+	sorted := make([]time.Duration, len(durations))
+	copy(sorted, durations)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	fmt.Fprintf(
+		w,
+		"  p50 %s  p90 %s  p99 %s  max %s\n",
+		round(percentile(sorted, 50)),
+		round(percentile(sorted, 90)),
+		round(percentile(sorted, 99)),
+		round(sorted[len(sorted)-1]),
+	)
+}
+
+// Nearest rank percentile of sorted durations
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	rank := int(p/100*float64(len(sorted))+0.5) - 1
+
+	if rank < 0 {
+		rank = 0
+	}
+
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+
+	return sorted[rank]
+}
+
+func perSecond(n int64, d time.Duration) float64 {
+	if d <= 0 {
+		return 0
+	}
+
+	return float64(n) / d.Seconds()
+}
+
+func percent(n int64, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+
+	return float64(n) / float64(total) * 100
+}
+
+func round(d time.Duration) time.Duration {
+	switch {
+	case d > time.Second:
+		return d.Round(time.Millisecond)
+	case d > time.Millisecond:
+		return d.Round(10 * time.Microsecond)
+	default:
+		return d.Round(time.Microsecond)
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/colevoss/gosock"
+)
+
+// Starts a hub that emits every event back to the channel it was sent on.
+// Returns the address it is listening on.
+func startEchoServer(addr string, pattern string, event string) (string, error) {
+	listener, err := net.Listen("tcp", addr)
+
+	if err != nil {
+		return "", err
+	}
+
+	hub := gosock.NewHub(gosock.NewPool(1000, 100, time.Minute))
+
+	hub.Channel(routePattern(pattern), func(r *gosock.Router) {
+		// Channels without a join handler can not be joined
+		r.On(r.Join(func(ctx context.Context, c *gosock.Channel) error {
+			return nil
+		}))
+
+		r.Event(event, func(ctx context.Context, c *gosock.Channel) error {
+			var payload json.RawMessage
+
+			if err := gosock.BindPayload(ctx, &payload); err != nil {
+				return err
+			}
+
+			return c.Emit(ctx, event, payload)
+		})
+	})
+
+	hub.Start()
+
+	go http.Serve(listener, hub)
+
+	return listener.Addr().String(), nil
+}
@@ -0,0 +1,137 @@
+// Command gosock-cli is an interactive client for debugging gosock servers.
+// It connects to a hub, runs commands typed at a prompt or read from stdin,
+// and pretty prints every response the server sends.
+//
+//	gosock-cli -url ws://localhost:8080 -H 'Authorization: Bearer token'
+//	> join chat.123
+//	> send chat {"message":"hi"}
+//	> leave
+//
+// Piping a script runs it and waits for responses before exiting, which makes
+// bug reports reproducible:
+//
+//	gosock-cli -url ws://localhost:8080 -wait 2s < repro.txt
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/colevoss/gosock/internal/wsclient"
+	"github.com/gobwas/ws"
+)
+
+type headerFlag http.Header
+
+func (h headerFlag) String() string {
+	return ""
+}
+
+func (h headerFlag) Set(value string) error {
+	key, val, ok := strings.Cut(value, ":")
+
+	if !ok {
+		return fmt.Errorf("Header must be formatted as 'Key: Value'. Got %s", value)
+	}
+
+	http.Header(h).Add(strings.TrimSpace(key), strings.TrimSpace(val))
+
+	return nil
+}
+
+var (
+	url     = flag.String("url", "ws://localhost:8080", "Server to connect to")
+	channel = flag.String("channel", "", "Only print responses on channels matching this pattern")
+	event   = flag.String("event", "", "Only print responses with events matching this pattern")
+	raw     = flag.Bool("raw", false, "Print responses as received instead of pretty printing")
+	wait    = flag.Duration("wait", time.Second, "Time to wait for responses after a script ends")
+	timeout = flag.Duration("timeout", 10*time.Second, "Time to wait for the connection")
+)
+
+func main() {
+	headers := headerFlag(http.Header{})
+	flag.Var(headers, "H", "Header sent with the upgrade request. Can be repeated.")
+	flag.Parse()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	dialer := ws.Dialer{Header: ws.HandshakeHeaderHTTP(http.Header(headers))}
+	conn, br, _, err := dialer.Dial(ctx, *url)
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not connect to %s: %s\n", *url, err)
+		os.Exit(1)
+	}
+
+	interactive := isTerminal(os.Stdin)
+
+	out := newPrinter(os.Stdout, *raw)
+	out.filter.channel = *channel
+	out.filter.event = *event
+
+	if interactive {
+		out.prompt = "> "
+	}
+
+	session := newSession(wsclient.New(conn, br), out)
+	closed := make(chan struct{})
+
+	go func() {
+		session.read()
+		close(closed)
+	}()
+
+	out.printf("Connected to %s\n", *url)
+
+	scanner := bufio.NewScanner(os.Stdin)
+
+	for out.showPrompt(); scanner.Scan(); out.showPrompt() {
+		if !interactive {
+			out.printf("%s\n", scanner.Text())
+		}
+
+		if err := session.run(scanner.Text()); err == errQuit {
+			break
+		} else if err != nil {
+			out.printf("error: %s\n", err)
+
+			// Scripts stop at the first failed command
+			if !interactive {
+				break
+			}
+		}
+
+		select {
+		case <-closed:
+			out.printf("Connection closed\n")
+			return
+		default:
+		}
+	}
+
+	if !interactive {
+		select {
+		case <-closed:
+		case <-time.After(*wait):
+		}
+	}
+
+	session.close()
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+
+	if err != nil {
+		return false
+	}
+
+	return info.Mode()&os.ModeCharDevice != 0
+}
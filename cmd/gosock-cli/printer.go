@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"sync"
+	"time"
+)
+
+// Which responses are printed. Empty patterns match everything.
+type filter struct {
+	channel string
+	event   string
+}
+
+func (f filter) match(channel string, event string) bool {
+	return matchPattern(f.channel, channel) && matchPattern(f.event, event)
+}
+
+func matchPattern(pattern string, value string) bool {
+	if pattern == "" || pattern == value {
+		return true
+	}
+
+	matched, _ := path.Match(pattern, value)
+
+	return matched
+}
+
+// Writes output without interleaving lines from the reader and the prompt
+type printer struct {
+	sync.Mutex
+
+	w      io.Writer
+	raw    bool
+	prompt string
+	filter filter
+}
+
+func newPrinter(w io.Writer, raw bool) *printer {
+	return &printer{
+		w:   w,
+		raw: raw,
+	}
+}
+
+func (p *printer) getFilter() filter {
+	p.Lock()
+	defer p.Unlock()
+
+	return p.filter
+}
+
+func (p *printer) setFilter(f filter) {
+	p.Lock()
+	defer p.Unlock()
+
+	p.filter = f
+}
+
+func (p *printer) printf(format string, args ...interface{}) {
+	p.Lock()
+	defer p.Unlock()
+
+	fmt.Fprintf(p.w, format, args...)
+}
+
+func (p *printer) showPrompt() {
+	if p.prompt != "" {
+		p.printf("%s", p.prompt)
+	}
+}
+
+// Prints a response from the server if it passes the filter
+func (p *printer) response(data []byte) {
+	var response struct {
+		Channel string          `json:"channel"`
+		Event   string          `json:"event"`
+		Payload json.RawMessage `json:"payload"`
+	}
+
+	if err := json.Unmarshal(data, &response); err != nil {
+		p.printf("\r<- invalid response: %s\n", bytes.TrimSpace(data))
+		p.showPrompt()
+		return
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	if !p.filter.match(response.Channel, response.Event) {
+		return
+	}
+
+	fmt.Fprintf(p.w, "\r%s\n", formatResponse(response.Channel, response.Event, response.Payload, data, p.raw))
+	fmt.Fprint(p.w, p.prompt)
+}
+
+func formatResponse(channel string, event string, payload json.RawMessage, data []byte, raw bool) string {
+	timestamp := time.Now().Format("15:04:05.000")
+
+	if raw {
+		return fmt.Sprintf("%s <- %s", timestamp, bytes.TrimSpace(data))
+	}
+
+	if channel == "" {
+		channel = "-"
+	}
+
+	header := fmt.Sprintf("%s <- [%s] %s", timestamp, channel, event)
+
+	if len(payload) == 0 || string(payload) == "null" {
+		return header
+	}
+
+	var pretty bytes.Buffer
+
+	if err := json.Indent(&pretty, payload, "   ", "  "); err != nil {
+		return header + " " + string(payload)
+	}
+
+	return header + "\n   " + pretty.String()
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/colevoss/gosock"
+	"github.com/colevoss/gosock/internal/wsclient"
+	"github.com/gobwas/ws/wsutil"
+)
+
+const usage = `Commands:
+  join <channel>                 Join a channel and make it the current channel
+  leave [channel]                Leave a channel, the current one by default
+  use <channel>                  Make a channel the current channel
+  send <event> [json]            Send an event to the current channel
+  sendto <channel> <event> [json]
+                                 Send an event to any channel
+  filter channel|event <pattern> Only print matching responses. * matches anything
+  filter off                     Print every response
+  sleep <duration>               Pause a script, such as 500ms
+  help                           Show this help
+  quit                           Close the connection and exit
+
+Lines starting with # are ignored.
+`
+
+// How long to wait for the server to read the close frame
+const closeTimeout = time.Second
+
+var errQuit = errors.New("quit")
+
+type message struct {
+	Channel string          `json:"channel"`
+	Event   string          `json:"event"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+type session struct {
+	conn *wsclient.Conn
+	out  *printer
+
+	current string
+}
+
+func newSession(conn *wsclient.Conn, out *printer) *session {
+	return &session{
+		conn: conn,
+		out:  out,
+	}
+}
+
+// Runs a single command line
+func (s *session) run(line string) error {
+	line = strings.TrimSpace(line)
+
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil
+	}
+
+	name, args, _ := strings.Cut(line, " ")
+	args = strings.TrimSpace(args)
+
+	switch name {
+	case "join":
+		if args == "" {
+			return errors.New("join requires a channel")
+		}
+
+		s.current = args
+		return s.send(args, gosock.JoinEventName, "")
+
+	case "leave":
+		channel := args
+
+		if channel == "" {
+			channel = s.current
+		}
+
+		if channel == "" {
+			return errors.New("No channel to leave")
+		}
+
+		if channel == s.current {
+			s.current = ""
+		}
+
+		return s.send(channel, gosock.LeaveEventName, "")
+
+	case "use":
+		if args == "" {
+			return errors.New("use requires a channel")
+		}
+
+		s.current = args
+		return nil
+
+	case "send":
+		if s.current == "" {
+			return errors.New("No current channel. Join one or use sendto")
+		}
+
+		event, payload, _ := strings.Cut(args, " ")
+
+		if event == "" {
+			return errors.New("send requires an event")
+		}
+
+		return s.send(s.current, event, payload)
+
+	case "sendto":
+		channel, rest, _ := strings.Cut(args, " ")
+		event, payload, _ := strings.Cut(strings.TrimSpace(rest), " ")
+
+		if channel == "" || event == "" {
+			return errors.New("sendto requires a channel and an event")
+		}
+
+		return s.send(channel, event, payload)
+
+	case "filter":
+		return s.filter(args)
+
+	case "sleep":
+		d, err := time.ParseDuration(args)
+
+		if err != nil {
+			return err
+		}
+
+		time.Sleep(d)
+		return nil
+
+	case "help":
+		s.out.printf("%s", usage)
+		return nil
+
+	case "quit", "exit":
+		return errQuit
+	}
+
+	return fmt.Errorf("Unknown command %s. Type help for a list of commands", name)
+}
+
+func (s *session) filter(args string) error {
+	kind, pattern, _ := strings.Cut(args, " ")
+	pattern = strings.TrimSpace(pattern)
+
+	switch kind {
+	case "off":
+		s.out.setFilter(filter{})
+		return nil
+
+	case "channel", "event":
+		if pattern == "" {
+			return fmt.Errorf("filter %s requires a pattern", kind)
+		}
+
+		f := s.out.getFilter()
+
+		if kind == "channel" {
+			f.channel = pattern
+		} else {
+			f.event = pattern
+		}
+
+		s.out.setFilter(f)
+		return nil
+	}
+
+	return errors.New("filter requires channel, event or off")
+}
+
+func (s *session) send(channel string, event string, payload string) error {
+	msg := message{
+		Channel: channel,
+		Event:   event,
+	}
+
+	if payload = strings.TrimSpace(payload); payload != "" {
+		if !json.Valid([]byte(payload)) {
+			return fmt.Errorf("Payload is not valid JSON: %s", payload)
+		}
+
+		msg.Payload = json.RawMessage(payload)
+	}
+
+	data, err := json.Marshal(msg)
+
+	if err != nil {
+		return err
+	}
+
+	return s.conn.WriteText(data)
+}
+
+// Prints responses until the connection closes
+func (s *session) read() {
+	for {
+		data, err := s.conn.Read()
+
+		if err != nil {
+			var closed wsutil.ClosedError
+
+			if errors.As(err, &closed) {
+				s.out.printf("Server closed the connection: %d %s\n", closed.Code, closed.Reason)
+			}
+
+			return
+		}
+
+		s.out.response(data)
+	}
+}
+
+// Sends a close frame and closes the socket
+func (s *session) close() {
+	s.conn.Close(closeTimeout)
+}
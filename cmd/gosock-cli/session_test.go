@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/colevoss/gosock"
+	"github.com/colevoss/gosock/internal/wsclient"
+	"github.com/gobwas/ws"
+)
+
+type syncBuffer struct {
+	sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.Lock()
+	defer b.Unlock()
+
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.Lock()
+	defer b.Unlock()
+
+	return b.buf.String()
+}
+
+func TestFilterMatch(t *testing.T) {
+	tests := []struct {
+		filter  filter
+		channel string
+		event   string
+		want    bool
+	}{
+		{filter{}, "chat.1", "chat", true},
+		{filter{channel: "chat.*"}, "chat.1", "chat", true},
+		{filter{channel: "chat.*"}, "room.1", "chat", false},
+		{filter{event: "typing"}, "chat.1", "chat", false},
+		{filter{channel: "chat.1", event: "chat"}, "chat.1", "chat", true},
+	}
+
+	for _, test := range tests {
+		if got := test.filter.match(test.channel, test.event); got != test.want {
+			t.Errorf("Filter %+v on %s %s should be %t. Got %t", test.filter, test.channel, test.event, test.want, got)
+		}
+	}
+}
+
+func TestSessionScript(t *testing.T) {
+	hub := gosock.NewHub(gosock.NewPool(10, 4, time.Second))
+
+	hub.Channel("chat.{id}", func(r *gosock.Router) {
+		r.On(r.Join(func(ctx context.Context, c *gosock.Channel) error {
+			return nil
+		}))
+
+		r.Event("chat", func(ctx context.Context, c *gosock.Channel) error {
+			var payload json.RawMessage
+			gosock.BindPayload(ctx, &payload)
+
+			return c.Reply(ctx, "chat", payload)
+		})
+	})
+
+	hub.Start()
+
+	server := httptest.NewServer(hub)
+	defer server.Close()
+
+	conn, br, _, err := ws.Dial(context.Background(), "ws"+strings.TrimPrefix(server.URL, "http"))
+
+	if err != nil {
+		t.Fatalf("Could not connect: %s", err)
+	}
+
+	var out syncBuffer
+	s := newSession(wsclient.New(conn, br), newPrinter(&out, false))
+	defer s.close()
+
+	go s.read()
+
+	script := []string{
+		"# comment",
+		"join chat.1",
+		`send chat {"message":"hi"}`,
+	}
+
+	for _, line := range script {
+		if err := s.run(line); err != nil {
+			t.Fatalf("%s failed: %s", line, err)
+		}
+	}
+
+	deadline := time.Now().Add(time.Second)
+
+	for !strings.Contains(out.String(), `"message": "hi"`) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if !strings.Contains(out.String(), "[chat.1] chat") || !strings.Contains(out.String(), `"message": "hi"`) {
+		t.Errorf("Expected pretty printed chat reply. Got %s", out.String())
+	}
+
+	errors := []string{"send chat {bad", "sendto chat.1", "filter nope", "bogus"}
+
+	for _, line := range errors {
+		if err := s.run(line); err == nil {
+			t.Errorf("%s should fail", line)
+		}
+	}
+
+	if err := s.run("quit"); err != errQuit {
+		t.Errorf("quit should return errQuit. Got %v", err)
+	}
+}
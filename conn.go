@@ -3,16 +3,34 @@ package gosock
 import (
 	"context"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"log"
 	"net"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
 
 	"github.com/gobwas/ws"
 	"github.com/gobwas/ws/wsutil"
 )
 
-var connId = 0
+type CloseCode uint16
+
+const (
+	CloseNormal          CloseCode = CloseCode(ws.StatusNormalClosure)
+	CloseGoingAway       CloseCode = CloseCode(ws.StatusGoingAway)
+	ClosePolicyViolation CloseCode = CloseCode(ws.StatusPolicyViolation)
+	CloseMessageTooBig   CloseCode = CloseCode(ws.StatusMessageTooBig)
+	CloseInternalError   CloseCode = CloseCode(ws.StatusInternalServerError)
+)
+
+// Close frame payloads are limited to 125 bytes, 2 of which are the code
+const maxCloseReasonLength = 123
+
+// How long Close waits to write the close frame to a slow client
+const closeWriteTimeout = time.Second
 
 type Conn struct {
 	sync.RWMutex
@@ -24,10 +42,51 @@ type Conn struct {
 
 	channels map[*Channel]bool
 
-	ctx context.Context
+	// Copied from the hub when the connection is created
+	limits MessageLimits
+
+	// Derived from the upgrade request's context and cancelled when the
+	// connection disconnects
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	userId   string
+	identity *Identity
+	// Closes the connection if it does not authenticate in time or when its
+	// credentials expire
+	authTimer *time.Timer
+
+	// Token used to resume this connection after the socket drops
+	session string
+	// Set while the socket is gone and the session is waiting to be resumed
+	detached bool
+	// Messages sent while detached
+	buffer [][]byte
+
+	// Set when the server closes the connection so it is not kept for a
+	// session to resume
+	closing   bool
+	closeOnce sync.Once
+
+	// Values handlers store about the connection
+	state *State
+
+	connectedAt time.Time
+	bytesIn     atomic.Uint64
+	bytesOut    atomic.Uint64
+
+	// Limits all messages from the connection
+	limiter *tokenBucket
+	// Limits per event on each channel
+	eventLimiters bucketMap
 }
 
+// Context handlers receive for this connection. It keeps the upgrade
+// request's values and is cancelled when the connection disconnects.
 func (c *Conn) Context() context.Context {
+	c.RLock()
+	defer c.RUnlock()
+
 	if c.ctx != nil {
 		return c.ctx
 	}
@@ -35,49 +94,228 @@ func (c *Conn) Context() context.Context {
 	return context.Background()
 }
 
-func newConn(ctx context.Context, conn net.Conn, hub *Hub) *Conn {
+// Stores a value for the lifetime of the connection
+func (c *Conn) Set(key string, val interface{}) {
+	c.state.Set(key, val)
+}
+
+func (c *Conn) Get(key string) (interface{}, bool) {
+	return c.state.Get(key)
+}
+
+func (c *Conn) Delete(key string) {
+	c.state.Delete(key)
+}
+
+// Associates the connection with a user so it can be found with
+// Hub.JoinUser. Typically called from a Connect handler.
+func (c *Conn) SetUserId(userId string) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.userId = userId
+}
+
+func (c *Conn) UserId() string {
+	c.RLock()
+	defer c.RUnlock()
+
+	return c.userId
+}
+
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+func (c *Conn) ConnectedAt() time.Time {
+	return c.connectedAt
+}
+
+// Bytes of messages received from the client
+func (c *Conn) BytesIn() uint64 {
+	return c.bytesIn.Load()
+}
+
+// Bytes written to the socket, including frame headers
+func (c *Conn) BytesOut() uint64 {
+	return c.bytesOut.Load()
+}
+
+// Paths of the channels the connection has joined
+func (c *Conn) Channels() []string {
+	c.RLock()
+	defer c.RUnlock()
+
+	paths := make([]string, 0, len(c.channels))
+
+	for channel := range c.channels {
+		paths = append(paths, channel.Path())
+	}
+
+	sort.Strings(paths)
+
+	return paths
+}
+
+func newConn(ctx context.Context, id string, conn net.Conn, hub *Hub) *Conn {
+	// The request's context ends when the upgrade handler returns so only
+	// its values are kept
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+
+	hub.RLock()
+	limits := hub.limits
+	hub.RUnlock()
+
 	connection := &Conn{
 		ctx:      ctx,
-		Id:       fmt.Sprintf("conn-%d", connId),
+		cancel:   cancel,
+		Id:       id,
 		conn:     conn,
 		hub:      hub,
 		channels: make(map[*Channel]bool),
-	}
+		limits:   limits,
+		state:    NewState(),
 
-	connId++
+		connectedAt: time.Now(),
+	}
 
 	return connection
 }
 
-func (c *Conn) close() {
+// Sends a close frame with code and reason and closes the socket. Channel
+// disconnect handlers run once the read loop exits. Connections closed by the
+// server are never kept for a session to resume.
+func (c *Conn) Close(code CloseCode, reason string) error {
+	reason = truncateCloseReason(reason)
+
+	c.Lock()
+
+	if c.closing {
+		c.Unlock()
+		return nil
+	}
+
+	c.closing = true
+	detached := c.detached
+
+	var err error
+
+	if !detached {
+		body := ws.NewCloseFrameBody(ws.StatusCode(code), reason)
+		c.conn.SetWriteDeadline(time.Now().Add(closeWriteTimeout))
+		err = ws.WriteFrame(c.conn, ws.NewCloseFrame(body))
+	}
+
+	c.Unlock()
+
+	// The socket is already gone so end the session now
+	if detached {
+		if c.hub.sessions.take(c.session, nil) != nil {
+			c.disconnect()
+		}
+
+		return nil
+	}
+
 	c.conn.Close()
 
+	return err
+}
+
+// Cuts reason to fit in a close frame without splitting a multi-byte rune
+func truncateCloseReason(reason string) string {
+	if len(reason) <= maxCloseReasonLength {
+		return reason
+	}
+
+	end := maxCloseReasonLength
+
+	for end > 0 && !utf8.RuneStart(reason[end]) {
+		end--
+	}
+
+	return reason[:end]
+}
+
+// Called when the read loop exits
+func (c *Conn) close() {
+	c.closeOnce.Do(func() {
+		c.conn.Close()
+
+		c.RLock()
+		closing := c.closing
+		c.RUnlock()
+
+		if !closing && c.hub.sessions != nil && c.hub.sessions.detach(c) {
+			return
+		}
+
+		c.disconnect()
+	})
+}
+
+// Removes the connection from its channels and the hub
+func (c *Conn) disconnect() {
+	c.stopAuthTimer()
+
 	c.RLock()
-	chans := c.channels
+	chans := make([]*Channel, 0, len(c.channels))
+
+	for ch := range c.channels {
+		chans = append(chans, ch)
+	}
 	c.RUnlock()
 
-	for ch := range chans {
-		c.hub.pool.Schedule(func() {
-			ch.handleDisconnect(c)
-		})
+	for _, channel := range chans {
+		channel.handleDisconnect(c)
 	}
 
+	c.cancelContext()
 	c.hub.disconnect <- c
 }
 
+// Cancels the context of every handler still running for the connection
+func (c *Conn) cancelContext() {
+	c.RLock()
+	cancel := c.cancel
+	c.RUnlock()
+
+	if cancel != nil {
+		cancel()
+	}
+}
+
 func (c *Conn) WithContext(ctx context.Context) *Conn {
 	if ctx == nil {
 		panic("nil context")
 	}
 
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+
+	c.Lock()
+	defer c.Unlock()
+
+	if c.cancel != nil {
+		c.cancel()
+	}
+
 	c.ctx = ctx
+	c.cancel = cancel
 	return c
 }
 
 func (c *Conn) read() {
 	defer c.close()
 
-	reader := wsutil.NewReader(c.conn, ws.StateServerSide)
+	// Replies to pings and echoes close frames as required by RFC 6455
+	controlHandler := wsutil.ControlFrameHandler(connWriter{c}, ws.StateServerSide)
+
+	reader := &wsutil.Reader{
+		Source:         c.conn,
+		State:          ws.StateServerSide,
+		CheckUTF8:      true,
+		OnIntermediate: controlHandler,
+	}
 
 	for {
 		hdr, err := reader.NextFrame()
@@ -87,25 +325,63 @@ func (c *Conn) read() {
 			return
 		}
 
-		if hdr.OpCode == ws.OpClose {
+		if hdr.OpCode.IsControl() {
+			if err := controlHandler(hdr, reader); err != nil {
+				if closed, ok := err.(wsutil.ClosedError); ok {
+					log.Printf("Connection %s closed by client %d %s", c.Id, closed.Code, closed.Reason)
+				} else {
+					log.Printf("Error handling control frame %v", err)
+				}
+
+				return
+			}
+
+			continue
+		}
+
+		limits := c.limits
+
+		// Reject single frame messages before reading any of the payload
+		if limits.MaxMessageSize > 0 && hdr.Fin && hdr.Length > limits.MaxMessageSize {
+			c.Close(CloseMessageTooBig, ErrMessageTooBig.Error())
+			return
+		}
+
+		data, err := readMessage(reader, limits.MaxMessageSize)
+
+		if errors.Is(err, ErrMessageTooBig) {
+			c.Close(CloseMessageTooBig, err.Error())
 			return
 		}
 
-		if hdr.OpCode == ws.OpPing {
-			log.Printf("PING")
+		if err != nil {
+			log.Printf("Error reading client data %v", err)
+			return
 		}
 
+		c.bytesIn.Add(uint64(len(data)))
+
 		var req Message
 
-		decoder := json.NewDecoder(reader)
-		if err := decoder.Decode(&req); err != nil {
+		if err := json.Unmarshal(data, &req); err != nil {
 			log.Printf("Error decoding client data %v", err)
 			return
 		}
 
-		c.hub.pool.Schedule(func() {
-			c.hub.handleMessage(c, &req)
-		})
+		if err := limits.validate(data, &req); err != nil {
+			c.sendResponse(&Response{
+				Channel: req.Channel,
+				Event:   ErrorEventName,
+				Payload: J{"error": err.Error()},
+			})
+			continue
+		}
+
+		if c.limiter != nil && !c.hub.allowMessage(c, &req, connectionScope, c.limiter) {
+			continue
+		}
+
+		c.hub.dispatch(c, &req)
 	}
 }
 
@@ -113,13 +389,58 @@ func (c *Conn) sendRaw(msg []byte) {
 	c.Lock()
 	defer c.Unlock()
 
-	_, err := c.conn.Write(msg)
+	c.writeLocked(msg)
+}
+
+// Writes to the socket or buffers the message if the connection is detached.
+// Must be called while holding the lock.
+func (c *Conn) writeLocked(msg []byte) {
+	if c.detached {
+		c.bufferLocked(msg)
+		return
+	}
+
+	n, err := c.conn.Write(msg)
+	c.bytesOut.Add(uint64(n))
 
 	if err != nil {
 		log.Printf("Error sending raw message %s", err)
 	}
 }
 
+func (c *Conn) bufferLocked(msg []byte) {
+	if len(c.buffer) >= c.hub.sessions.bufferSize {
+		log.Printf("Session buffer full for connection %s. Dropping oldest message", c.Id)
+		c.buffer = c.buffer[1:]
+	}
+
+	c.buffer = append(c.buffer, msg)
+}
+
+func (c *Conn) sendResponse(response *Response) {
+	msg, err := response.Encode()
+
+	if err != nil {
+		log.Printf("Error encoding response %s", err)
+		return
+	}
+
+	c.sendRaw(msg)
+}
+
+// Writes control frame replies while holding the connection lock so they do
+// not interleave with messages
+type connWriter struct {
+	conn *Conn
+}
+
+func (w connWriter) Write(p []byte) (int, error) {
+	w.conn.Lock()
+	defer w.conn.Unlock()
+
+	return w.conn.conn.Write(p)
+}
+
 func (c *Conn) addChannel(channel *Channel) {
 	c.Lock()
 	defer c.Unlock()
@@ -129,9 +450,10 @@ func (c *Conn) addChannel(channel *Channel) {
 
 func (c *Conn) removeChannel(channel *Channel) {
 	c.Lock()
-	defer c.Unlock()
-
 	delete(c.channels, channel)
+	c.Unlock()
+
+	c.eventLimiters.deletePrefix(eventBucketKey(channel.path, ""))
 }
 
 type ConnectionMap struct {
@@ -0,0 +1,298 @@
+package gosock
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsutil"
+)
+
+func makeTestConn(t *testing.T) (*Conn, net.Conn) {
+	t.Helper()
+
+	hub := makeHub()
+	hub.Start()
+
+	server, client := net.Pipe()
+	t.Cleanup(func() { client.Close() })
+
+	conn := newConn(context.Background(), "test", server, hub)
+
+	return conn, client
+}
+
+func TestReadEchoesClientClose(t *testing.T) {
+	conn, client := makeTestConn(t)
+
+	done := make(chan struct{})
+
+	go func() {
+		conn.read()
+		close(done)
+	}()
+
+	body := ws.NewCloseFrameBody(ws.StatusGoingAway, "bye")
+	frame := ws.MaskFrameInPlace(ws.NewCloseFrame(body))
+
+	go ws.WriteFrame(client, frame)
+
+	echo, err := ws.ReadFrame(client)
+
+	if err != nil {
+		t.Fatalf("Should receive close echo: %s", err)
+	}
+
+	code, _ := ws.ParseCloseFrameData(echo.Payload)
+
+	if echo.Header.OpCode != ws.OpClose || code != ws.StatusGoingAway {
+		t.Errorf("Echo should be a close frame with code %d. Got %v %d", ws.StatusGoingAway, echo.Header.OpCode, code)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Errorf("Read loop should exit after close frame")
+	}
+}
+
+func TestCloseSendsCloseFrame(t *testing.T) {
+	conn, client := makeTestConn(t)
+
+	go conn.Close(ClosePolicyViolation, "banned")
+
+	frame, err := ws.ReadFrame(client)
+
+	if err != nil {
+		t.Fatalf("Should receive close frame: %s", err)
+	}
+
+	code, reason := ws.ParseCloseFrameData(frame.Payload)
+
+	if code != ws.StatusPolicyViolation || reason != "banned" {
+		t.Errorf("Close frame should have code and reason. Got %d %s", code, reason)
+	}
+
+	if err := conn.Close(CloseNormal, ""); err != nil {
+		t.Errorf("Closing twice should be a no-op. Got %s", err)
+	}
+}
+
+func TestTruncateCloseReason(t *testing.T) {
+	ascii := strings.Repeat("a", 200)
+	accent := strings.Repeat("a", maxCloseReasonLength-1) + "é"
+
+	tests := []struct {
+		reason string
+		want   string
+	}{
+		{"banned", "banned"},
+		{ascii, ascii[:maxCloseReasonLength]},
+		// é is 2 bytes and would be split at the limit
+		{accent, accent[:maxCloseReasonLength-1]},
+	}
+
+	for _, test := range tests {
+		got := truncateCloseReason(test.reason)
+
+		if got != test.want || !utf8.ValidString(got) {
+			t.Errorf("Expected %d byte reason. Got %d bytes %q", len(test.want), len(got), got)
+		}
+	}
+}
+
+func TestCloseSlowClient(t *testing.T) {
+	conn, _ := makeTestConn(t)
+
+	done := make(chan error, 1)
+
+	// The client never reads the close frame
+	go func() { done <- conn.Close(CloseNormal, "") }()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Errorf("Close should report the failed write")
+		}
+	case <-time.After(closeWriteTimeout + time.Second):
+		t.Fatalf("Close should not block on a client that is not reading")
+	}
+}
+
+func TestDisconnectUser(t *testing.T) {
+	hub := makeHub()
+	hub.Start()
+
+	expires := time.Now().Add(time.Hour)
+	clients := map[string]net.Conn{}
+
+	users := []struct {
+		id     string
+		userId string
+	}{
+		{"alice-1", "alice"},
+		{"alice-2", "alice"},
+		{"bob", "bob"},
+	}
+
+	for _, user := range users {
+		conn, client := makePipeConn(t, hub, user.id)
+		conn.authenticate(&Identity{UserId: user.userId, ExpiresAt: expires})
+		hub.addConn(conn)
+		clients[user.id] = client
+	}
+
+	frames := make(chan ws.Frame, 2)
+
+	for _, id := range []string{"alice-1", "alice-2"} {
+		client := clients[id]
+
+		go func() {
+			client.SetReadDeadline(time.Now().Add(time.Second))
+			frame, _ := ws.ReadFrame(client)
+			frames <- frame
+		}()
+	}
+
+	go hub.DisconnectUser("alice", CloseGoingAway, "signed out")
+
+	for i := 0; i < 2; i++ {
+		code, reason := ws.ParseCloseFrameData((<-frames).Payload)
+
+		if code != ws.StatusGoingAway || reason != "signed out" {
+			t.Errorf("Expected close %d signed out. Got %d %s", ws.StatusGoingAway, code, reason)
+		}
+	}
+
+	// Other users stay connected
+	clients["bob"].SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+
+	if _, err := ws.ReadFrame(clients["bob"]); err == nil {
+		t.Errorf("Other users should not be disconnected")
+	}
+}
+
+func TestReadClosesOversizedMessage(t *testing.T) {
+	hub := makeHub()
+	hub.MessageLimits(MessageLimits{MaxMessageSize: 16})
+	hub.Start()
+
+	conn, client := makePipeConn(t, hub, "test")
+
+	go conn.read()
+
+	frame := ws.MaskFrameInPlace(ws.NewTextFrame([]byte(`{"channel":"chat.1","event":"chat"}`)))
+
+	go ws.WriteFrame(client, frame)
+
+	resp, err := ws.ReadFrame(client)
+
+	if err != nil {
+		t.Fatalf("Should receive close frame: %s", err)
+	}
+
+	code, _ := ws.ParseCloseFrameData(resp.Payload)
+
+	if resp.Header.OpCode != ws.OpClose || code != ws.StatusMessageTooBig {
+		t.Errorf("Should close with %d. Got %v %d", ws.StatusMessageTooBig, resp.Header.OpCode, code)
+	}
+}
+
+func TestContextCancelledOnDisconnect(t *testing.T) {
+	type key struct{}
+
+	conn, _ := makeTestConn(t)
+	conn.WithContext(context.WithValue(context.Background(), key{}, "value"))
+
+	ctx := conn.Context()
+
+	if ctx.Value(key{}) != "value" {
+		t.Errorf("Context should keep the request's values")
+	}
+
+	conn.disconnect()
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Errorf("Context should be cancelled on disconnect")
+	}
+}
+
+func TestHandlerTimeout(t *testing.T) {
+	conn, client := makeTestConn(t)
+	hub := conn.hub
+
+	cancelled := make(chan struct{})
+
+	hub.Channel("room", func(r *Router) {
+		r.Event("slow", func(ctx context.Context, c *Channel) error {
+			<-ctx.Done()
+			close(cancelled)
+			return ctx.Err()
+		}, WithTimeout(10*time.Millisecond))
+	})
+
+	channel, _ := hub.registry.acquire("room")
+	defer hub.registry.release(channel)
+
+	channel.addConnection(conn)
+
+	go hub.handleMessage(conn, &Message{Channel: "room", Event: "slow"})
+
+	client.SetReadDeadline(time.Now().Add(time.Second))
+	data, err := wsutil.ReadServerText(client)
+
+	if err != nil {
+		t.Fatalf("Expected a timeout reply. Got %s", err)
+	}
+
+	var response struct {
+		Event   string `json:"event"`
+		Payload J      `json:"payload"`
+	}
+
+	if err := json.Unmarshal(data, &response); err != nil {
+		t.Fatalf("Could not decode reply. Got %s", err)
+	}
+
+	if response.Event != ErrorEventName || response.Payload["error"] != ErrHandlerTimeout.Error() {
+		t.Errorf("Expected %s error. Got %s %v", ErrHandlerTimeout, response.Event, response.Payload)
+	}
+
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Errorf("Handler context should be cancelled after the timeout")
+	}
+}
+
+func TestDisconnectWithFullPool(t *testing.T) {
+	hub := makeHub()
+	hub.pool.SetRejectionPolicy(RejectDrop)
+	hub.Channel("room.{id}", func(r *Router) {})
+	hub.Start()
+
+	conn := makeDrainedConn(t, hub, "member")
+	channel, err := hub.Join(conn, "room.1")
+
+	if err != nil {
+		t.Fatalf("Join failed: %s", err)
+	}
+
+	block := fillPool(t, hub.pool)
+	defer close(block)
+
+	conn.close()
+
+	if channel.hasConn(conn) {
+		t.Errorf("Disconnected connection should leave its channels even when the pool is full")
+	}
+
+	waitForChannels(t, hub, 0)
+}
@@ -19,6 +19,12 @@ func withParams(ctx context.Context, params *Params) context.Context {
 	return context.WithValue(ctx, ctxKey("params"), params)
 }
 
+// Builds the context a handler receives when conn sends msg to channel. Lets
+// handlers be called directly in tests.
+func NewHandlerContext(conn *Conn, channel *Channel, msg *Message) context.Context {
+	return withMessage(channel.handlerContext(conn), msg)
+}
+
 func GetParams(ctx context.Context) *Params {
 	params := ctx.Value(ctxKey("params"))
 
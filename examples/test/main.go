@@ -24,14 +24,15 @@ func main() {
 	chatRouter := chat.NewChatRouter(db)
 
 	pool := gosock.NewPool(10, 10, time.Second*60)
-	pool.OnPanic(func(err interface{}) {
-		log.Printf("Fuck %v", err)
+	pool.OnPanic(func(report *gosock.PanicReport) {
+		log.Print(report)
 	})
 
 	server := gosock.NewHub(pool)
 	redisManager := &producers.RedisManager{}
 	redisManager.Connect()
 	server.AddProducerManager(redisManager)
+	server.AddMembership(redisManager.Membership())
 
 	server.Use(middleware.UserMiddleware)
 
@@ -0,0 +1,137 @@
+package producers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/colevoss/gosock"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// Sorted set of node ids scored by their last heartbeat
+	nodesKey = "gosock:nodes"
+)
+
+// Hash of conn id -> node id for a channel
+func membersKey(path string) string {
+	return fmt.Sprintf("gosock:members:%s", path)
+}
+
+// Set of channel paths a node has members in
+func nodeChannelsKey(node string) string {
+	return fmt.Sprintf("gosock:node:%s:channels", node)
+}
+
+// Removes a member and drops the channel from its node's set once the node
+// has no members left in it. Runs as a script so a concurrent Add on the same
+// node can not be lost.
+var removeMemberScript = redis.NewScript(`
+redis.call("HDEL", KEYS[1], ARGV[1])
+
+for _, node in ipairs(redis.call("HVALS", KEYS[1])) do
+	if node == ARGV[2] then
+		return 0
+	end
+end
+
+return redis.call("SREM", KEYS[2], ARGV[3])
+`)
+
+type RedisMembership struct {
+	rdb *redis.Client
+}
+
+func NewRedisMembership(rdb *redis.Client) *RedisMembership {
+	return &RedisMembership{rdb}
+}
+
+func (rm *RedisManager) Membership() gosock.Membership {
+	return NewRedisMembership(rm.rdb)
+}
+
+func (rm *RedisMembership) Add(ctx context.Context, node string, path string, connId string) error {
+	pipe := rm.rdb.TxPipeline()
+	pipe.HSet(ctx, membersKey(path), connId, node)
+	pipe.SAdd(ctx, nodeChannelsKey(node), path)
+
+	_, err := pipe.Exec(ctx)
+
+	return err
+}
+
+func (rm *RedisMembership) Remove(ctx context.Context, node string, path string, connId string) error {
+	keys := []string{membersKey(path), nodeChannelsKey(node)}
+
+	return removeMemberScript.Run(ctx, rm.rdb, keys, connId, node, path).Err()
+}
+
+func (rm *RedisMembership) Count(ctx context.Context, path string) (int, error) {
+	count, err := rm.rdb.HLen(ctx, membersKey(path)).Result()
+
+	return int(count), err
+}
+
+func (rm *RedisMembership) Heartbeat(ctx context.Context, node string) error {
+	return rm.rdb.ZAdd(ctx, nodesKey, redis.Z{
+		Score:  float64(time.Now().Unix()),
+		Member: node,
+	}).Err()
+}
+
+func (rm *RedisMembership) Prune(ctx context.Context, ttl time.Duration) error {
+	deadline := time.Now().Add(-ttl).Unix()
+
+	dead, err := rm.rdb.ZRangeByScore(ctx, nodesKey, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(deadline, 10),
+	}).Result()
+
+	if err != nil {
+		return err
+	}
+
+	for _, node := range dead {
+		if err := rm.pruneNode(ctx, node); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (rm *RedisMembership) pruneNode(ctx context.Context, node string) error {
+	paths, err := rm.rdb.SMembers(ctx, nodeChannelsKey(node)).Result()
+
+	if err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		members, err := rm.rdb.HGetAll(ctx, membersKey(path)).Result()
+
+		if err != nil {
+			return err
+		}
+
+		for connId, memberNode := range members {
+			if memberNode != node {
+				continue
+			}
+
+			if err := rm.rdb.HDel(ctx, membersKey(path), connId).Err(); err != nil {
+				return err
+			}
+		}
+	}
+
+	pipe := rm.rdb.TxPipeline()
+	pipe.Del(ctx, nodeChannelsKey(node))
+	pipe.ZRem(ctx, nodesKey, node)
+
+	_, err = pipe.Exec(ctx)
+
+	return err
+}
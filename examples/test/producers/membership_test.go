@@ -0,0 +1,95 @@
+package producers
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Connects to the redis server at GOSOCK_REDIS_ADDR. Tests use their own
+// database and flush it when they finish.
+func makeRedisMembership(t *testing.T) (*RedisMembership, *redis.Client) {
+	t.Helper()
+
+	addr := os.Getenv("GOSOCK_REDIS_ADDR")
+
+	if addr == "" {
+		t.Skip("GOSOCK_REDIS_ADDR is not set")
+	}
+
+	ctx := context.Background()
+	rdb := redis.NewClient(&redis.Options{Addr: addr, DB: 15})
+
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		t.Fatalf("Could not connect to redis at %s: %s", addr, err)
+	}
+
+	rdb.FlushDB(ctx)
+
+	t.Cleanup(func() {
+		rdb.FlushDB(ctx)
+		rdb.Close()
+	})
+
+	return NewRedisMembership(rdb), rdb
+}
+
+func TestRedisMembershipCount(t *testing.T) {
+	ctx := context.Background()
+	rm, rdb := makeRedisMembership(t)
+
+	rm.Add(ctx, "node-a", "chat.1", "conn-1")
+	rm.Add(ctx, "node-a", "chat.1", "conn-2")
+	rm.Add(ctx, "node-b", "chat.1", "conn-3")
+
+	if count, _ := rm.Count(ctx, "chat.1"); count != 3 {
+		t.Errorf("Count should equal 3. Got %d", count)
+	}
+
+	rm.Remove(ctx, "node-a", "chat.1", "conn-1")
+
+	if count, _ := rm.Count(ctx, "chat.1"); count != 2 {
+		t.Errorf("Count should equal 2 after remove. Got %d", count)
+	}
+
+	// node-a still has conn-2 in chat.1
+	if member, _ := rdb.SIsMember(ctx, nodeChannelsKey("node-a"), "chat.1").Result(); !member {
+		t.Errorf("Channel should stay in the node's set while it has members")
+	}
+
+	rm.Remove(ctx, "node-a", "chat.1", "conn-2")
+
+	if member, _ := rdb.SIsMember(ctx, nodeChannelsKey("node-a"), "chat.1").Result(); member {
+		t.Errorf("Channel should leave the node's set with its last member")
+	}
+}
+
+func TestRedisMembershipPrune(t *testing.T) {
+	ctx := context.Background()
+	rm, rdb := makeRedisMembership(t)
+
+	rm.Heartbeat(ctx, "node-a")
+	rm.Add(ctx, "node-a", "chat.1", "conn-1")
+	rm.Add(ctx, "node-b", "chat.1", "conn-2")
+
+	// node-b stops sending heartbeats
+	rdb.ZAdd(ctx, nodesKey, redis.Z{
+		Score:  float64(time.Now().Add(-time.Minute).Unix()),
+		Member: "node-b",
+	})
+
+	if err := rm.Prune(ctx, time.Second*30); err != nil {
+		t.Fatalf("Prune failed: %s", err)
+	}
+
+	if count, _ := rm.Count(ctx, "chat.1"); count != 1 {
+		t.Errorf("Stale node members should be pruned. Got count %d", count)
+	}
+
+	if exists, _ := rdb.Exists(ctx, nodeChannelsKey("node-b")).Result(); exists != 0 {
+		t.Errorf("Pruned node's channel set should be deleted")
+	}
+}
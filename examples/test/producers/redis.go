@@ -29,6 +29,10 @@ func (rm *RedisManager) onConnect(ctx context.Context, conn *redis.Conn) error {
 	return nil
 }
 
+func (rm *RedisManager) Health(ctx context.Context) error {
+	return rm.rdb.Ping(ctx).Err()
+}
+
 func (rm *RedisManager) Create(channel *gosock.Channel) gosock.Producer {
 	return NewReddisProducer(rm, channel)
 }
@@ -48,9 +52,9 @@ func NewReddisProducer(manager *RedisManager, channel *gosock.Channel) *RedisPro
 
 func (rp *RedisProducer) Subscribe() {
 	ctx := context.Background()
-	path := rp.channel.Path()
+	key := rp.channel.Key()
 
-	rp.pubsub = rp.manager.rdb.Subscribe(ctx, path)
+	rp.pubsub = rp.manager.rdb.Subscribe(ctx, key)
 
 	go rp.subscribe()
 }
@@ -78,7 +82,7 @@ func (rp *RedisProducer) subscribe() {
 func (rp *RedisProducer) Publish(ctx context.Context, msg *gosock.ChannelMessage) error {
 	// For now just trying sending the response payload
 	// TODO: Need to try sending ChannelMessage as payload
-	pub := rp.manager.rdb.Publish(ctx, msg.Response.Channel, msg.Response)
+	pub := rp.manager.rdb.Publish(ctx, rp.channel.Key(), msg.Response)
 
 	if err := pub.Err(); err != nil {
 		log.Printf("Error sending msg to redis channel %+v %s", msg, err)
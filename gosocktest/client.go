@@ -0,0 +1,236 @@
+// Package gosocktest provides an in-process client for testing gosock hubs,
+// routers and handlers without a network listener or HTTP upgrade.
+package gosocktest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/colevoss/gosock"
+	"github.com/colevoss/gosock/internal/wsclient"
+)
+
+const defaultTimeout = time.Second
+
+var ErrTimeout = errors.New("Timed out waiting for response")
+
+// A fake client connected to a hub through an in-memory pipe. Messages go
+// through the same read loop, middleware and handlers as a real socket.
+type Client struct {
+	// Server side of the connection
+	Conn *gosock.Conn
+
+	// How long Next and Expect wait for a response. Defaults to 1 second.
+	Timeout time.Duration
+
+	t    testing.TB
+	hub  *gosock.Hub
+	conn *wsclient.Conn
+
+	responses chan *gosock.Response
+}
+
+// Connects a client to hub. The hub must be started. The client is closed
+// when the test finishes.
+func NewClient(t testing.TB, hub *gosock.Hub) *Client {
+	return NewClientContext(t, hub, context.Background())
+}
+
+// Connects a client whose connection context is ctx, such as one holding
+// values a hub middleware would normally set
+func NewClientContext(t testing.TB, hub *gosock.Hub, ctx context.Context) *Client {
+	t.Helper()
+
+	server, client := net.Pipe()
+
+	c := &Client{
+		Timeout:   defaultTimeout,
+		t:         t,
+		hub:       hub,
+		conn:      wsclient.New(client, nil),
+		responses: make(chan *gosock.Response, 256),
+	}
+
+	// Must be reading before the hub writes its welcome message
+	go c.read()
+
+	c.Conn = hub.ServeConn(ctx, server)
+	t.Cleanup(c.Close)
+
+	if _, err := c.next(gosock.ConnectedEventName); err != nil {
+		t.Fatalf("Client did not receive %s: %s", gosock.ConnectedEventName, err)
+	}
+
+	return c
+}
+
+func (c *Client) read() {
+	defer close(c.responses)
+
+	for {
+		data, err := c.conn.Read()
+
+		if err != nil {
+			return
+		}
+
+		response, err := gosock.ResponseFromBytes(data)
+
+		if err != nil {
+			c.t.Errorf("Client received invalid response %s: %s", data, err)
+			continue
+		}
+
+		c.responses <- response
+	}
+}
+
+// Sends an event to a channel as the client would. Payload is encoded as JSON.
+func (c *Client) Send(channel string, event string, payload interface{}) error {
+	msg, err := newMessage(channel, event, payload)
+
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(msg)
+
+	if err != nil {
+		return err
+	}
+
+	return c.conn.WriteText(data)
+}
+
+func (c *Client) Join(channel string) error {
+	return c.Send(channel, gosock.JoinEventName, nil)
+}
+
+func (c *Client) Leave(channel string) error {
+	return c.Send(channel, gosock.LeaveEventName, nil)
+}
+
+// Returns the next response or ErrTimeout if none arrives in time
+func (c *Client) Next() (*gosock.Response, error) {
+	return c.next("")
+}
+
+// Skips responses until one for event arrives, or any response if event is
+// empty
+func (c *Client) next(event string) (*gosock.Response, error) {
+	timer := time.NewTimer(c.Timeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case response, ok := <-c.responses:
+			if !ok {
+				return nil, io.EOF
+			}
+
+			if event == "" || response.Event == event {
+				return response, nil
+			}
+
+		case <-timer.C:
+			return nil, ErrTimeout
+		}
+	}
+}
+
+// Waits for a response with the given channel and event, skipping any
+// others, and fails the test if none arrives in time
+func (c *Client) Expect(channel string, event string) *gosock.Response {
+	c.t.Helper()
+
+	timer := time.NewTimer(c.Timeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case response, ok := <-c.responses:
+			if !ok {
+				c.t.Fatalf("Connection closed waiting for %s on %s", event, channel)
+				return nil
+			}
+
+			if response.Channel == channel && response.Event == event {
+				return response
+			}
+
+		case <-timer.C:
+			c.t.Fatalf("Timed out waiting for %s on %s", event, channel)
+			return nil
+		}
+	}
+}
+
+// Fails the test if any response arrives within d
+func (c *Client) ExpectNone(d time.Duration) {
+	c.t.Helper()
+
+	select {
+	case response, ok := <-c.responses:
+		if ok {
+			c.t.Errorf("Expected no response. Got %s on %s", response.Event, response.Channel)
+		}
+	case <-time.After(d):
+	}
+}
+
+// Calls handler directly with the context it would receive if the client sent
+// event to channel. The channel is created if needed but not joined.
+func (c *Client) Invoke(handler gosock.EventHandler, channel string, event string, payload interface{}) error {
+	msg, err := newMessage(channel, event, payload)
+
+	if err != nil {
+		return err
+	}
+
+	return c.hub.WithChannel(channel, func(ch *gosock.Channel) error {
+		return handler(gosock.NewHandlerContext(c.Conn, ch, msg), ch)
+	})
+}
+
+// Sends a close frame and closes the client's end of the pipe
+func (c *Client) Close() {
+	// The server may have closed already and stopped reading
+	c.conn.Close(c.Timeout)
+}
+
+// Decodes a response's payload into v
+func Bind(response *gosock.Response, v interface{}) error {
+	data, err := json.Marshal(response.Payload)
+
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+func newMessage(channel string, event string, payload interface{}) (*gosock.Message, error) {
+	msg := &gosock.Message{
+		Channel: channel,
+		Event:   event,
+	}
+
+	if payload == nil {
+		return msg, nil
+	}
+
+	data, err := json.Marshal(payload)
+
+	if err != nil {
+		return nil, err
+	}
+
+	msg.Payload = data
+
+	return msg, nil
+}
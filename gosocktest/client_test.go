@@ -0,0 +1,107 @@
+package gosocktest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/colevoss/gosock"
+)
+
+type chatPayload struct {
+	Text string `json:"text"`
+}
+
+func makeHub(t *testing.T) *gosock.Hub {
+	t.Helper()
+
+	hub := gosock.NewHub(gosock.NewPool(10, 4, time.Second))
+
+	hub.Channel("chat.{id}", func(r *gosock.Router) {
+		r.On(r.Join(func(ctx context.Context, c *gosock.Channel) error {
+			id, _ := c.Params().Get("id")
+			return c.Reply(ctx, "welcome", gosock.J{"id": id})
+		}))
+
+		r.Event("chat", func(ctx context.Context, c *gosock.Channel) error {
+			var payload chatPayload
+
+			if err := gosock.BindPayload(ctx, &payload); err != nil {
+				return err
+			}
+
+			return c.Reply(ctx, "chat", payload)
+		})
+	})
+
+	hub.Start()
+
+	return hub
+}
+
+func TestClientJoinAndSend(t *testing.T) {
+	client := NewClient(t, makeHub(t))
+
+	if err := client.Join("chat.1"); err != nil {
+		t.Fatalf("Join failed: %s", err)
+	}
+
+	welcome := client.Expect("chat.1", "welcome")
+
+	var joined struct {
+		Id string `json:"id"`
+	}
+
+	if err := Bind(welcome, &joined); err != nil || joined.Id != "1" {
+		t.Errorf("Expected welcome for channel 1. Got %v %v", welcome.Payload, err)
+	}
+
+	if err := client.Send("chat.1", "chat", chatPayload{Text: "hi"}); err != nil {
+		t.Fatalf("Send failed: %s", err)
+	}
+
+	var reply chatPayload
+
+	if err := Bind(client.Expect("chat.1", "chat"), &reply); err != nil || reply.Text != "hi" {
+		t.Errorf("Expected chat reply hi. Got %s %v", reply.Text, err)
+	}
+
+	client.ExpectNone(20 * time.Millisecond)
+}
+
+func TestClientInvoke(t *testing.T) {
+	client := NewClient(t, makeHub(t))
+
+	handler := func(ctx context.Context, c *gosock.Channel) error {
+		id, _ := gosock.Param(ctx, "id")
+
+		var payload chatPayload
+
+		if err := gosock.BindPayload(ctx, &payload); err != nil {
+			return err
+		}
+
+		return c.Reply(ctx, "echo", gosock.J{"id": id, "text": payload.Text})
+	}
+
+	if err := client.Invoke(handler, "chat.7", "chat", chatPayload{Text: "hello"}); err != nil {
+		t.Fatalf("Invoke failed: %s", err)
+	}
+
+	var echo struct {
+		Id   string `json:"id"`
+		Text string `json:"text"`
+	}
+
+	if err := Bind(client.Expect("chat.7", "echo"), &echo); err != nil {
+		t.Fatalf("Could not bind echo: %s", err)
+	}
+
+	if echo.Id != "7" || echo.Text != "hello" {
+		t.Errorf("Expected echo 7 hello. Got %s %s", echo.Id, echo.Text)
+	}
+
+	if err := client.Invoke(handler, "missing", "chat", nil); err == nil {
+		t.Errorf("Invoke on an unrouted channel should fail")
+	}
+}
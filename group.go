@@ -0,0 +1,112 @@
+package gosock
+
+import (
+	"context"
+	"strings"
+)
+
+// Group registers routers under a shared pattern prefix. Routers in a group
+// inherit the group's middleware and before join checks, and because the
+// prefix is part of their pattern, its params are available to every handler.
+//
+//	hub.Group("org.{orgId}", func(g *gosock.Group) {
+//		g.BeforeJoin(checkOrgMember)
+//
+//		g.Channel("chat.{roomId}", func(r *gosock.Router) {
+//			// Handlers see both orgId and roomId
+//		})
+//	})
+type Group struct {
+	hub    *Hub
+	prefix string
+
+	middlewares []EventMiddleware
+	beforeJoins []EventHandler
+}
+
+func (h *Hub) Group(prefix string, handler func(*Group)) {
+	group := &Group{
+		hub:    h,
+		prefix: prefix,
+	}
+
+	handler(group)
+}
+
+// Pattern prefix of the group including any parent group prefixes
+func (g *Group) Prefix() string {
+	return g.prefix
+}
+
+// Adds middleware to every router registered in the group after this call,
+// including routers in nested groups
+func (g *Group) Use(middlewares ...EventMiddleware) {
+	g.middlewares = append(g.middlewares, middlewares...)
+}
+
+// Adds a check that runs before a router's own before join handler for every
+// router registered in the group after this call. Returning an error rejects
+// the join.
+func (g *Group) BeforeJoin(handler EventHandler) {
+	g.beforeJoins = append(g.beforeJoins, handler)
+}
+
+// Creates a nested group whose prefix is appended to this group's prefix
+func (g *Group) Group(prefix string, handler func(*Group)) {
+	group := &Group{
+		hub:         g.hub,
+		prefix:      g.join(prefix),
+		middlewares: append([]EventMiddleware{}, g.middlewares...),
+		beforeJoins: append([]EventHandler{}, g.beforeJoins...),
+	}
+
+	handler(group)
+}
+
+// Registers a router for the group prefix followed by path
+func (g *Group) Channel(path string, handler func(*Router)) {
+	middlewares := g.middlewares
+	beforeJoins := g.beforeJoins
+
+	g.hub.Channel(g.join(path), func(r *Router) {
+		r.Use(middlewares...)
+		handler(r)
+
+		if len(beforeJoins) == 0 {
+			return
+		}
+
+		checks := append([]EventHandler{}, beforeJoins...)
+
+		if own, ok := r.routerHandlers[beforeJoinEventName]; ok {
+			checks = append(checks, own)
+		}
+
+		r.routerHandlers[beforeJoinEventName] = chainHandlers(checks)
+	})
+}
+
+func (g *Group) join(path string) string {
+	if path == "" {
+		return g.prefix
+	}
+
+	if g.prefix == "" {
+		return path
+	}
+
+	return strings.TrimSuffix(g.prefix, ".") + "." + strings.TrimPrefix(path, ".")
+}
+
+// Runs handlers in order stopping at the first error
+func chainHandlers(handlers []EventHandler) EventHandler {
+	return func(ctx context.Context, c *Channel) error {
+		for _, handler := range handlers {
+			if err := handler(ctx, c); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,102 @@
+package gosock
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestGroupPatterns(t *testing.T) {
+	hub := makeHub()
+
+	hub.Group("org.{orgId}", func(g *Group) {
+		g.Channel("chat.{roomId}", func(r *Router) {})
+
+		g.Group("team.{teamId}", func(g *Group) {
+			g.Channel("", func(r *Router) {})
+			g.Channel("docs", func(r *Router) {})
+		})
+	})
+
+	want := []string{
+		"org.{orgId}.chat.{roomId}",
+		"org.{orgId}.team.{teamId}",
+		"org.{orgId}.team.{teamId}.docs",
+	}
+
+	routes := hub.Routes()
+
+	if len(routes) != len(want) {
+		t.Fatalf("Should have %d routes. Got %d", len(want), len(routes))
+	}
+
+	for i, route := range routes {
+		if route.Pattern != want[i] {
+			t.Errorf("got %s, wanted %s", route.Pattern, want[i])
+		}
+	}
+
+	match, params := hub.channels.Lookup("org.1.chat.2")
+
+	if match == nil || match.Channel == nil {
+		t.Fatalf("Grouped router should be found")
+	}
+
+	if orgId, _ := params.Get("orgId"); orgId != "1" {
+		t.Errorf("Group params should be available. Got orgId=%s", orgId)
+	}
+}
+
+func TestGroupBeforeJoin(t *testing.T) {
+	hub := makeHub()
+	errDenied := errors.New("denied")
+
+	var calls []string
+
+	hub.Group("org.{orgId}", func(g *Group) {
+		g.BeforeJoin(func(ctx context.Context, c *Channel) error {
+			calls = append(calls, "group")
+			return nil
+		})
+
+		g.Use(func(next EventHandler) EventHandler {
+			return func(ctx context.Context, c *Channel) error {
+				calls = append(calls, "middleware")
+				return next(ctx, c)
+			}
+		})
+
+		g.Group("admin", func(g *Group) {
+			g.BeforeJoin(func(ctx context.Context, c *Channel) error {
+				calls = append(calls, "nested")
+				return errDenied
+			})
+
+			g.Channel("", func(r *Router) {
+				r.On(r.BeforeJoin(func(ctx context.Context, c *Channel) error {
+					calls = append(calls, "router")
+					return nil
+				}))
+			})
+		})
+	})
+
+	match, _ := hub.channels.Lookup("org.1.admin")
+	beforeJoin, _ := match.Channel.lifecycleHandler(beforeJoinEventName)
+
+	if err := beforeJoin(context.Background(), nil); err != errDenied {
+		t.Errorf("Nested check should reject join. Got %v", err)
+	}
+
+	want := []string{"middleware", "group", "nested"}
+
+	if len(calls) != len(want) {
+		t.Fatalf("got calls %v, wanted %v", calls, want)
+	}
+
+	for i := range want {
+		if calls[i] != want[i] {
+			t.Errorf("got calls %v, wanted %v", calls, want)
+		}
+	}
+}
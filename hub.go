@@ -2,15 +2,40 @@ package gosock
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/gobwas/ws"
 )
 
 const connectEventName = "__connect__"
 
+var (
+	ErrChannelNotFound    = errors.New("Channel not found")
+	ErrHandlerTimeout     = errors.New("Handler timed out")
+	ErrConnectionNotFound = errors.New("Connection not found")
+)
+
+// How incoming messages are ordered before they reach handlers
+type MessageOrdering uint8
+
+const (
+	// Messages from a connection are handled one at a time in the order they
+	// arrived
+	OrderByConnection MessageOrdering = iota
+	// Messages to a channel are handled one at a time in the order they
+	// arrived, across all of its members
+	OrderByChannel
+	// Every message is handled as soon as a worker is free
+	OrderNone
+)
+
 type ConnectionHandler func(conn *Conn)
 type ServerEventInit func(hub *Hub)
 type Middleware func(http.HandlerFunc) http.HandlerFunc
@@ -31,9 +56,32 @@ type Hub struct {
 
 	handle http.HandlerFunc
 
-	channelCache map[string]*Channel
+	registry *channelRegistry
 
 	producerManager ProducerManager
+
+	nodeId      string
+	idGenerator IdGenerator
+	membership  Membership
+	heartbeat   time.Duration
+
+	sessions *sessionManager
+
+	namespace string
+
+	connLimit   *RateLimit
+	rateLimited rateLimitCounters
+
+	limits MessageLimits
+
+	allowedOrigins []string
+	originChecker  OriginChecker
+	csrfChecker    CSRFChecker
+
+	auth *authConfig
+
+	ordering MessageOrdering
+	ordered  *KeyedPool
 }
 
 func NewHub(pool *Pool) *Hub {
@@ -44,11 +92,18 @@ func NewHub(pool *Pool) *Hub {
 		disconnect:  make(chan *Conn),
 		handlers:    make(map[string]ConnectionHandler),
 		pool:        pool,
+		ordered:     NewKeyedPool(pool),
 		middlewares: []Middleware{},
 
-		channelCache: make(map[string]*Channel),
+		nodeId:      newNodeId(),
+		idGenerator: ULIDGenerator,
+		membership:  NewMemoryMembership(),
+		heartbeat:   defaultHeartbeatInterval,
+
+		limits: DefaultMessageLimits,
 	}
 
+	hub.registry = newChannelRegistry(hub)
 	hub.AddProducerManager(&BaseProducerManager{})
 
 	return hub
@@ -61,6 +116,89 @@ func (h *Hub) AddProducerManager(manager ProducerManager) {
 	h.producerManager = manager
 }
 
+// Sets the registry used to track channel members across nodes
+func (h *Hub) AddMembership(membership Membership) {
+	h.Lock()
+	defer h.Unlock()
+
+	h.membership = membership
+}
+
+// Membership registry in use. AddMembership may swap it while connections
+// are joining and leaving.
+func (h *Hub) getMembership() Membership {
+	h.RLock()
+	defer h.RUnlock()
+
+	return h.membership
+}
+
+// Sets how often this node reports that it is alive to the membership
+// registry. Nodes that miss three heartbeats are considered dead and their
+// memberships are pruned.
+func (h *Hub) SetHeartbeat(interval time.Duration) {
+	h.Lock()
+	defer h.Unlock()
+
+	h.heartbeat = interval
+}
+
+// Keeps a connection's channel memberships for grace after its socket drops.
+// Clients are sent a session token when they connect and can send it back in a
+// __resume__ event on a new socket to reattach to their channels and receive
+// any messages that were sent in the meantime. At most bufferSize messages are
+// buffered per connection.
+func (h *Hub) EnableSessions(grace time.Duration, bufferSize int) {
+	h.Lock()
+	defer h.Unlock()
+
+	h.sessions = newSessionManager(grace, bufferSize)
+}
+
+// Sets the function used to create connection ids. Defaults to ULIDGenerator.
+func (h *Hub) SetIdGenerator(generator IdGenerator) {
+	h.Lock()
+	defer h.Unlock()
+
+	h.idGenerator = generator
+}
+
+// Name of the namespace this hub was mounted with by a Server. Empty for
+// standalone hubs.
+func (h *Hub) Namespace() string {
+	return h.namespace
+}
+
+// Sets how incoming messages are ordered. Defaults to OrderByConnection.
+func (h *Hub) SetOrdering(ordering MessageOrdering) {
+	h.Lock()
+	defer h.Unlock()
+
+	h.ordering = ordering
+}
+
+// Schedules a message to be handled according to the hub's ordering
+func (h *Hub) dispatch(conn *Conn, msg *Message) {
+	task := func() {
+		defer h.recoverMessage(conn, msg)
+		h.handleMessage(conn, msg)
+	}
+
+	switch h.ordering {
+	case OrderByConnection:
+		h.ordered.schedule(conn.Context(), conn.Id, task)
+	case OrderByChannel:
+		h.ordered.schedule(conn.Context(), msg.Channel, task)
+	default:
+		h.pool.schedule(conn.Context(), task)
+	}
+}
+
+// Unique id of this node in a cluster
+func (h *Hub) NodeId() string {
+	return h.nodeId
+}
+
 func (h *Hub) Use(middlewares ...Middleware) {
 	h.middlewares = append(h.middlewares, middlewares...)
 }
@@ -73,6 +211,7 @@ func Connect(handler ConnectionHandler) ServerEventInit {
 
 func (h *Hub) Start() {
 	go h.run()
+	go h.runHeartbeat()
 
 	h.handle = h.wrapHandler()
 }
@@ -103,10 +242,41 @@ func (h *Hub) On(s ...ServerEventInit) *Hub {
 	return h
 }
 
+// Registers a router for a channel pattern. Panics if the pattern is invalid
+// or conflicts with a pattern that has already been registered.
 func (h *Hub) Channel(path string, handler func(*Router)) {
 	router := NewRouter(path, h)
 	handler(router)
-	h.channels.Add(path, router)
+
+	if err := h.channels.Add(path, router); err != nil {
+		panic(err)
+	}
+}
+
+// Describes a registered router
+type Route struct {
+	Pattern         string   `json:"pattern"`
+	Events          []string `json:"events"`
+	LifecycleEvents []string `json:"lifecycleEvents"`
+}
+
+// Every registered route sorted by pattern
+func (h *Hub) Routes() []Route {
+	var routes []Route
+
+	for _, router := range h.channels.Routers() {
+		routes = append(routes, Route{
+			Pattern:         router.Pattern(),
+			Events:          router.Events(),
+			LifecycleEvents: router.LifecycleEvents(),
+		})
+	}
+
+	sort.Slice(routes, func(i, j int) bool {
+		return routes[i].Pattern < routes[j].Pattern
+	})
+
+	return routes
 }
 
 func (h *Hub) run() {
@@ -122,6 +292,46 @@ func (h *Hub) run() {
 	}
 }
 
+func (h *Hub) runHeartbeat() {
+	h.RLock()
+	interval := h.heartbeat
+	h.RUnlock()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	h.beat(interval)
+
+	for range ticker.C {
+		h.beat(interval)
+	}
+}
+
+func (h *Hub) beat(interval time.Duration) {
+	ctx := context.Background()
+	membership := h.getMembership()
+
+	if err := membership.Heartbeat(ctx, h.nodeId); err != nil {
+		log.Printf("Error sending heartbeat for node %s: %s", h.nodeId, err)
+		return
+	}
+
+	if err := membership.Prune(ctx, interval*3); err != nil {
+		log.Printf("Error pruning stale members: %s", err)
+	}
+
+	h.closeOrphanedChannels()
+}
+
+// Closes channels that no longer have members on any node. Channels with no
+// local members are kept open while other nodes still have members so
+// messages sent from this node still reach them.
+func (h *Hub) closeOrphanedChannels() {
+	for _, channel := range h.registry.unused() {
+		channel.closeIfEmpty()
+	}
+}
+
 func (h *Hub) handleConnect(conn *Conn) {
 	handler, ok := h.handlers[connectEventName]
 
@@ -133,63 +343,177 @@ func (h *Hub) handleConnect(conn *Conn) {
 }
 
 func (h *Hub) Send(ctx context.Context, path string, event string, payload interface{}) {
-	channel, ok := h.channelCache[path]
+	channel, ok := h.registry.find(path)
+
+	if !ok {
+		log.Printf("Channel not found %s", path)
+		return
+	}
+
+	channel.Emit(ctx, event, payload)
+}
+
+// Finds the open channel for path. Channels are only opened by joining them
+// or with WithChannel.
+func (h *Hub) Lookup(path string) (*Channel, error) {
+	channel, ok := h.registry.find(path)
 
 	if !ok {
-		node, _ := h.channels.Lookup(path)
+		return nil, fmt.Errorf("%w: %s", ErrChannelNotFound, path)
+	}
 
-		if node == nil || node.Channel == nil {
-			log.Printf("Channel not found %s", path)
-			return
+	return channel, nil
+}
+
+// Calls fn with the channel for path, creating it if a router matches. The
+// channel is kept open until fn returns.
+func (h *Hub) WithChannel(path string, fn func(*Channel) error) error {
+	channel, err := h.registry.acquire(path)
+
+	if err != nil {
+		return err
+	}
+
+	defer h.registry.release(channel)
+
+	return fn(channel)
+}
+
+// Subscribes a connection to a channel from server code, creating the
+// channel if needed. The router's before join and join handlers run as if the
+// client had sent __join__ and the client is sent a __joined__ event.
+func (h *Hub) Join(conn *Conn, path string) (*Channel, error) {
+	channel, err := h.registry.acquire(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer h.registry.release(channel)
+
+	return channel, channel.AddConn(conn)
+}
+
+// Joins every connection belonging to a user to a channel. A connection that
+// fails to join does not stop the others. Returns the joined errors of every
+// connection that failed.
+func (h *Hub) JoinUser(userId string, path string) error {
+	var errs []error
+
+	for _, conn := range h.userConns(userId) {
+		if _, err := h.Join(conn, path); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", conn.Id, err))
 		}
+	}
 
-		router := node.Channel
-		channel, ok = router.channels[path]
+	return errors.Join(errs...)
+}
 
-		if !ok {
-			log.Printf("Channel does not exist in router %s", path)
-			return
+// Closes every connection belonging to a user
+func (h *Hub) DisconnectUser(userId string, code CloseCode, reason string) {
+	for _, conn := range h.userConns(userId) {
+		if err := conn.Close(code, reason); err != nil {
+			log.Printf("Error closing connection %s: %s", conn.Id, err)
 		}
 	}
+}
 
-	channel.Emit(ctx, event, payload)
+func (h *Hub) findConn(id string) (*Conn, error) {
+	h.RLock()
+	defer h.RUnlock()
+
+	for conn := range h.conns {
+		if conn.Id == id {
+			return conn, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrConnectionNotFound, id)
 }
 
-func (h *Hub) handleMessage(conn *Conn, msg *Message) {
-	channel, ok := h.channelCache[msg.Channel]
+func (h *Hub) userConns(userId string) []*Conn {
+	h.RLock()
+	defer h.RUnlock()
 
-	if !ok {
-		log.Printf("Channel not cached %s", msg.Channel)
-		node, params := h.channels.Lookup(msg.Channel)
+	var conns []*Conn
 
-		if node == nil || node.Channel == nil {
-			log.Printf("Channel not found %s", msg.Channel)
-			return
+	for conn := range h.conns {
+		if conn.UserId() == userId {
+			conns = append(conns, conn)
 		}
+	}
 
-		router := node.Channel
-		channel, ok = router.channels[msg.Channel]
+	return conns
+}
 
-		if !ok {
-			channel = router.addChannel(msg.Channel, params)
-			// This needs to be cleared at some point
-			h.Lock()
-			h.channelCache[msg.Channel] = channel
-			h.Unlock()
+// Only joins open a channel. Other events are for channels the client is
+// already in.
+func (h *Hub) acquireChannel(msg *Message) (*Channel, error) {
+	if msg.Event == JoinEventName {
+		return h.registry.acquire(msg.Channel)
+	}
+
+	channel, ok := h.registry.acquireOpen(msg.Channel)
+
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrChannelNotFound, msg.Channel)
+	}
+
+	return channel, nil
+}
+
+func (h *Hub) handleMessage(conn *Conn, msg *Message) {
+	switch msg.Event {
+	case AuthEventName, ReauthEventName:
+		h.handleAuth(conn, msg)
+		return
+	}
+
+	if h.auth != nil && !conn.Authenticated() {
+		conn.sendResponse(&Response{
+			Channel: msg.Channel,
+			Event:   ErrorEventName,
+			Payload: J{"error": ErrUnauthenticated.Error()},
+		})
+		return
+	}
+
+	if msg.Event == ResumeEventName {
+		h.handleResume(conn, msg)
+		return
+	}
+
+	// Keeps the channel open while the message is handled
+	channel, err := h.acquireChannel(msg)
+
+	if err != nil {
+		log.Printf("Could not open channel %s: %s", msg.Channel, err)
+
+		// The router's OnCreate hook failed so the join is rejected
+		if !errors.Is(err, ErrChannelNotFound) {
+			conn.sendResponse(&Response{
+				Channel: msg.Channel,
+				Event:   ErrorEventName,
+				Payload: J{"error": err.Error(), "event": msg.Event},
+			})
 		}
+
+		return
 	}
 
-	ctx := withConnection(conn.ctx, conn)
+	defer h.registry.release(channel)
+
+	ctx := channel.handlerContext(conn)
 
 	switch msg.Event {
-	case joinEventName:
+	case JoinEventName:
 		channel.handleJoin(ctx, msg)
 
-	case leaveEventName:
+	case LeaveEventName:
 		channel.handleLeave(ctx, msg)
 
 	default:
-		handler, ok := channel.router.handlers[msg.Event]
+		handler, ok := channel.router.eventHandler(msg.Event)
 
 		if !ok {
 			log.Printf("Channel does not have handler for event %s", msg.Event)
@@ -202,33 +526,125 @@ func (h *Hub) handleMessage(conn *Conn, msg *Message) {
 			return
 		}
 
+		if channel.limiter != nil && !h.allowMessage(conn, msg, channelScope, channel.limiter) {
+			return
+		}
+
+		options := channel.router.eventOptions(msg.Event)
+
+		if limit := options.rateLimit; limit != nil {
+			bucket := conn.eventLimiters.get(eventBucketKey(channel.path, msg.Event), *limit)
+
+			if !h.allowMessage(conn, msg, eventScope, bucket) {
+				return
+			}
+		}
+
 		ctx := withMessage(ctx, msg)
+
+		if options.timeout > 0 {
+			timeoutCtx, cancel := context.WithTimeout(ctx, options.timeout)
+			defer cancel()
+
+			stop := context.AfterFunc(timeoutCtx, func() {
+				if errors.Is(timeoutCtx.Err(), context.DeadlineExceeded) {
+					conn.sendResponse(&Response{
+						Channel: msg.Channel,
+						Event:   ErrorEventName,
+						Payload: J{"error": ErrHandlerTimeout.Error(), "event": msg.Event},
+					})
+				}
+			})
+			defer stop()
+
+			ctx = timeoutCtx
+		}
+
 		handler(ctx, channel)
 	}
 }
 
-func (h *Hub) removeCachedChannel(path string) {
-	h.Lock()
-	defer h.Unlock()
-	log.Printf("Removing cached channel %s", path)
+func (h *Hub) handler(w http.ResponseWriter, r *http.Request) {
+	if err := h.checkUpgrade(r); err != nil {
+		log.Printf("Rejected upgrade from %s: %s", r.Header.Get("Origin"), err)
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
 
-	delete(h.channelCache, path)
-}
+	var identity *Identity
+	upgrader := ws.HTTPUpgrader{}
 
-func (h *Hub) handler(w http.ResponseWriter, r *http.Request) {
-	conn, _, _, err := ws.UpgradeHTTP(r, w)
+	if h.auth != nil {
+		if token := h.auth.upgradeToken(r); token != "" {
+			var err error
+			identity, err = h.auth.authenticator.Authenticate(r.Context(), token)
+
+			if err != nil || identity == nil {
+				log.Printf("Rejected upgrade with invalid credentials: %v", err)
+				http.Error(w, ErrInvalidCredentials.Error(), http.StatusUnauthorized)
+				return
+			}
+		}
+
+		if h.auth.subprotocol != "" {
+			upgrader.Protocol = func(protocol string) bool {
+				return protocol == h.auth.subprotocol
+			}
+		}
+	}
+
+	conn, _, _, err := upgrader.Upgrade(r, w)
 
 	if err != nil {
-		log.Fatalf("Error upgrading http request %v", err)
+		log.Printf("Error upgrading http request %v", err)
 		return
 	}
 
-	ctx := r.Context()
-	c := newConn(ctx, conn, h)
+	h.serveConn(r.Context(), conn, identity)
+}
+
+// Serves a websocket connection that has already been upgraded, such as one
+// end of a net.Pipe in tests. The hub must be started.
+func (h *Hub) ServeConn(ctx context.Context, conn net.Conn) *Conn {
+	return h.serveConn(ctx, conn, nil)
+}
+
+func (h *Hub) serveConn(ctx context.Context, conn net.Conn, identity *Identity) *Conn {
+	h.RLock()
+	id := h.idGenerator(h.nodeId)
+	connLimit := h.connLimit
+	h.RUnlock()
+
+	c := newConn(ctx, id, conn, h)
+
+	if connLimit != nil {
+		c.limiter = newTokenBucket(*connLimit)
+	}
+
+	if identity != nil {
+		c.authenticate(identity)
+	} else if h.auth != nil {
+		c.requireAuth(h.auth.timeout)
+	}
+
+	c.sendResponse(&Response{
+		Event:   ConnectedEventName,
+		Payload: J{"id": c.Id},
+	})
+
+	if h.sessions != nil {
+		c.session = newSessionToken()
+		c.sendResponse(&Response{
+			Event:   SessionEventName,
+			Payload: J{"token": c.session},
+		})
+	}
 
 	h.connect <- c
 
 	go c.read()
+
+	return c
 }
 
 func (h *Hub) addConn(conn *Conn) {
@@ -0,0 +1,64 @@
+package gosock
+
+import (
+	"crypto/rand"
+	"time"
+)
+
+// Creates a unique id for a new connection on node. Generators are called
+// concurrently from every upgrade and must be safe for concurrent use.
+type IdGenerator func(node string) string
+
+// Crockford's base32 alphabet used by ULIDs
+const ulidEncoding = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// Default IdGenerator. Ids are a ULID prefixed with the node id so they are
+// sortable by creation time and unique across nodes and restarts.
+//
+//	3f9a1c2b4d5e6f70-01HCZ3T5Q8X9V2N4M6K7J8H9G0
+func ULIDGenerator(node string) string {
+	return node + "-" + newULID(time.Now())
+}
+
+func newULID(t time.Time) string {
+	var id [16]byte
+
+	ms := uint64(t.UnixMilli())
+
+	// 48 bit big endian timestamp
+	id[0] = byte(ms >> 40)
+	id[1] = byte(ms >> 32)
+	id[2] = byte(ms >> 24)
+	id[3] = byte(ms >> 16)
+	id[4] = byte(ms >> 8)
+	id[5] = byte(ms)
+
+	// 80 bits of randomness
+	if _, err := rand.Read(id[6:]); err != nil {
+		panic(err)
+	}
+
+	return encodeULID(id)
+}
+
+// Encodes 128 bits as 26 base32 characters, 5 bits at a time starting from
+// the least significant end. The first character only holds 3 bits.
+func encodeULID(id [16]byte) string {
+	var hi, lo uint64
+
+	for i := 0; i < 8; i++ {
+		hi = hi<<8 | uint64(id[i])
+		lo = lo<<8 | uint64(id[i+8])
+	}
+
+	dst := make([]byte, 26)
+
+	for i := 25; i >= 0; i-- {
+		dst[i] = ulidEncoding[lo&0x1f]
+
+		lo = lo>>5 | hi<<59
+		hi = hi >> 5
+	}
+
+	return string(dst)
+}
@@ -0,0 +1,76 @@
+package gosock
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEncodeULID(t *testing.T) {
+	var max [16]byte
+
+	for i := range max {
+		max[i] = 0xff
+	}
+
+	tests := []struct {
+		id   [16]byte
+		want string
+	}{
+		{[16]byte{}, "00000000000000000000000000"},
+		{max, "7ZZZZZZZZZZZZZZZZZZZZZZZZZ"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			got := encodeULID(tt.id)
+
+			if got != tt.want {
+				t.Errorf("got %s, wanted %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestULIDSortable(t *testing.T) {
+	first := newULID(time.UnixMilli(1000))
+	second := newULID(time.UnixMilli(2000))
+
+	if first[:10] >= second[:10] {
+		t.Errorf("ULID timestamps should sort by time. %s >= %s", first, second)
+	}
+}
+
+func TestULIDGeneratorUnique(t *testing.T) {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	ids := make(map[string]bool)
+
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			id := ULIDGenerator("node")
+
+			mu.Lock()
+			ids[id] = true
+			mu.Unlock()
+		}()
+	}
+
+	wg.Wait()
+
+	if len(ids) != 100 {
+		t.Errorf("Ids should be unique. Got %d unique ids", len(ids))
+	}
+
+	for id := range ids {
+		if !strings.HasPrefix(id, "node-") {
+			t.Errorf("Id should be prefixed with node id. Got %s", id)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+// Package wsclient is the client side of a websocket shared by gosocktest and
+// the command line tools.
+package wsclient
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsutil"
+)
+
+type Conn struct {
+	conn   net.Conn
+	reader io.Reader
+
+	// Guards writes so control frame replies do not interleave with messages
+	writeMu sync.Mutex
+}
+
+// Wraps a dialed socket. br holds any frames read along with the handshake
+// response and may be nil.
+func New(conn net.Conn, br *bufio.Reader) *Conn {
+	c := &Conn{
+		conn:   conn,
+		reader: conn,
+	}
+
+	if br != nil {
+		c.reader = io.MultiReader(br, conn)
+	}
+
+	return c
+}
+
+// Returns the next message from the server, replying to any control frames
+// read before it
+func (c *Conn) Read() ([]byte, error) {
+	rw := struct {
+		io.Reader
+		io.Writer
+	}{c.reader, writerFunc(c.write)}
+
+	data, _, err := wsutil.ReadServerData(rw)
+
+	return data, err
+}
+
+func (c *Conn) WriteText(data []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	return wsutil.WriteClientText(c.conn, data)
+}
+
+type writerFunc func([]byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
+
+func (c *Conn) write(p []byte) (int, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	return c.conn.Write(p)
+}
+
+// Sends a close frame and closes the socket. Gives up on the close frame
+// after timeout in case the server has stopped reading.
+func (c *Conn) Close(timeout time.Duration) error {
+	c.writeMu.Lock()
+	c.conn.SetWriteDeadline(time.Now().Add(timeout))
+	body := ws.NewCloseFrameBody(ws.StatusNormalClosure, "")
+	ws.WriteFrame(c.conn, ws.MaskFrameInPlace(ws.NewCloseFrame(body)))
+	c.writeMu.Unlock()
+
+	return c.conn.Close()
+}
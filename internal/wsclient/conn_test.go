@@ -0,0 +1,50 @@
+package wsclient
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gobwas/ws"
+	"github.com/gobwas/ws/wsutil"
+)
+
+func TestReadRepliesToPing(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+
+	conn := New(client, nil)
+	read := make(chan string, 1)
+
+	go func() {
+		data, _ := conn.Read()
+		read <- string(data)
+	}()
+
+	ws.WriteFrame(server, ws.NewPingFrame([]byte("ping")))
+
+	frame, err := ws.ReadFrame(server)
+
+	if err != nil || frame.Header.OpCode != ws.OpPong || !frame.Header.Masked {
+		t.Fatalf("Expected a masked pong. Got %+v %v", frame.Header, err)
+	}
+
+	wsutil.WriteServerText(server, []byte("hello"))
+
+	if data := <-read; data != "hello" {
+		t.Errorf("Read should return the message after the ping. Got %s", data)
+	}
+}
+
+func TestCloseSendsCloseFrame(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+
+	go New(client, nil).Close(time.Second)
+
+	frame, err := ws.ReadFrame(server)
+
+	if err != nil || frame.Header.OpCode != ws.OpClose || !frame.Header.Masked {
+		t.Errorf("Expected a masked close frame. Got %+v %v", frame.Header, err)
+	}
+}
@@ -0,0 +1,124 @@
+package gosock
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"strings"
+	"time"
+)
+
+var jwtAlgorithms = map[string]func() hash.Hash{
+	"HS256": sha256.New,
+	"HS384": sha512.New384,
+	"HS512": sha512.New,
+}
+
+// Authenticator for JWTs signed with HMAC. The `sub` claim is used as the
+// identity's user id and `exp` as its expiry. Tokens without `exp` never
+// expire.
+type JWTAuthenticator struct {
+	secret    []byte
+	algorithm string
+
+	// Allowed difference between this server's clock and the issuer's when
+	// checking exp and nbf
+	Leeway time.Duration
+}
+
+// Creates a JWTAuthenticator that accepts tokens signed with secret using
+// algorithm, one of HS256, HS384 or HS512
+func NewJWTAuthenticator(secret []byte, algorithm string) (*JWTAuthenticator, error) {
+	if _, ok := jwtAlgorithms[algorithm]; !ok {
+		return nil, fmt.Errorf("Unsupported JWT algorithm %s", algorithm)
+	}
+
+	return &JWTAuthenticator{
+		secret:    secret,
+		algorithm: algorithm,
+	}, nil
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+}
+
+func (ja *JWTAuthenticator) Authenticate(ctx context.Context, token string) (*Identity, error) {
+	parts := strings.Split(token, ".")
+
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidCredentials)
+	}
+
+	var header jwtHeader
+
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return nil, err
+	}
+
+	// Only accept the configured algorithm so a token can not pick a weaker
+	// one or "none"
+	if header.Alg != ja.algorithm {
+		return nil, fmt.Errorf("%w: unexpected algorithm %s", ErrInvalidCredentials, header.Alg)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed signature", ErrInvalidCredentials)
+	}
+
+	mac := hmac.New(jwtAlgorithms[ja.algorithm], ja.secret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return nil, fmt.Errorf("%w: bad signature", ErrInvalidCredentials)
+	}
+
+	var claims map[string]interface{}
+
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, err
+	}
+
+	identity := &Identity{Claims: claims, Leeway: ja.Leeway}
+	now := time.Now()
+
+	if sub, ok := claims["sub"].(string); ok {
+		identity.UserId = sub
+	}
+
+	if exp, ok := claims["exp"].(float64); ok {
+		identity.ExpiresAt = time.Unix(int64(exp), 0)
+
+		if now.After(identity.ExpiresAt.Add(ja.Leeway)) {
+			return nil, ErrCredentialsExpired
+		}
+	}
+
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(ja.Leeway).Before(time.Unix(int64(nbf), 0)) {
+		return nil, fmt.Errorf("%w: token not valid yet", ErrInvalidCredentials)
+	}
+
+	return identity, nil
+}
+
+func decodeJWTPart(part string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+
+	if err != nil {
+		return fmt.Errorf("%w: malformed token", ErrInvalidCredentials)
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%w: malformed token", ErrInvalidCredentials)
+	}
+
+	return nil
+}
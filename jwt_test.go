@@ -0,0 +1,86 @@
+package gosock
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func signJWT(t *testing.T, secret []byte, alg string, claims map[string]interface{}) string {
+	t.Helper()
+
+	header, _ := json.Marshal(jwtHeader{Alg: alg, Typ: "JWT"})
+	payload, _ := json.Marshal(claims)
+
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(unsigned))
+
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestJWTAuthenticator(t *testing.T) {
+	secret := []byte("secret")
+	auth, _ := NewJWTAuthenticator(secret, "HS256")
+
+	exp := time.Now().Add(time.Hour).Unix()
+
+	tests := []struct {
+		name  string
+		token string
+		err   error
+	}{
+		{"valid", signJWT(t, secret, "HS256", map[string]interface{}{"sub": "user-1", "exp": exp}), nil},
+		{"wrong secret", signJWT(t, []byte("other"), "HS256", map[string]interface{}{"sub": "user-1"}), ErrInvalidCredentials},
+		{"wrong alg", signJWT(t, secret, "none", map[string]interface{}{"sub": "user-1"}), ErrInvalidCredentials},
+		{"expired", signJWT(t, secret, "HS256", map[string]interface{}{"sub": "user-1", "exp": time.Now().Add(-time.Hour).Unix()}), ErrCredentialsExpired},
+		{"not before", signJWT(t, secret, "HS256", map[string]interface{}{"sub": "user-1", "nbf": time.Now().Add(time.Hour).Unix()}), ErrInvalidCredentials},
+		{"malformed", "not-a-token", ErrInvalidCredentials},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identity, err := auth.Authenticate(context.Background(), tt.token)
+
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got %v, wanted %v", err, tt.err)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if identity.UserId != "user-1" || identity.ExpiresAt.Unix() != exp {
+				t.Errorf("Identity should come from claims. Got %+v", identity)
+			}
+		})
+	}
+}
+
+// The leeway travels with the identity so wrapping the authenticator keeps it
+func TestJWTLeewayOnIdentity(t *testing.T) {
+	secret := []byte("secret")
+	jwt, _ := NewJWTAuthenticator(secret, "HS256")
+	jwt.Leeway = time.Minute
+
+	wrapped := AuthenticatorFunc(func(ctx context.Context, token string) (*Identity, error) {
+		return jwt.Authenticate(ctx, token)
+	})
+
+	token := signJWT(t, secret, "HS256", map[string]interface{}{"sub": "user-1", "exp": time.Now().Add(-time.Second).Unix()})
+	identity, err := wrapped.Authenticate(context.Background(), token)
+
+	if err != nil {
+		t.Fatalf("Token within the leeway should be accepted. Got %s", err)
+	}
+
+	if identity.Leeway != time.Minute {
+		t.Errorf("Identity should carry the authenticator's leeway. Got %s", identity.Leeway)
+	}
+}
@@ -0,0 +1,178 @@
+package gosock
+
+import (
+	"context"
+	"log"
+	"sync"
+)
+
+// Tasks that can wait for a key before Schedule applies the pool's rejection
+// policy
+const defaultKeyedQueueLimit = 128
+
+// KeyedPool runs tasks that share a key one at a time in the order they were
+// scheduled while tasks with different keys run in parallel on the
+// underlying pool.
+type KeyedPool struct {
+	sync.Mutex
+
+	pool *Pool
+
+	// Pending tasks for keys that have a runner
+	queues map[string]*keyedQueue
+	limit  int
+	// Signalled whenever a queue shrinks or is removed
+	space *sync.Cond
+
+	// Tasks dropped because the pool rejected their key's runner
+	rejected uint64
+}
+
+type keyedQueue struct {
+	tasks []PoolTask
+}
+
+func NewKeyedPool(pool *Pool) *KeyedPool {
+	kp := &KeyedPool{
+		pool:   pool,
+		queues: make(map[string]*keyedQueue),
+		limit:  defaultKeyedQueueLimit,
+	}
+
+	kp.space = sync.NewCond(&kp.Mutex)
+
+	return kp
+}
+
+// Sets how many tasks can wait for a single key. Once a key's queue is full
+// the pool's rejection policy applies. RejectCallerRuns waits like
+// RejectBlock since running the task early would break its key's order. A
+// limit of 0 or less never rejects.
+func (kp *KeyedPool) SetQueueLimit(limit int) {
+	kp.Lock()
+	defer kp.Unlock()
+
+	kp.limit = limit
+}
+
+// Queues task behind the other tasks for key. Returns false if the task was
+// dropped.
+func (kp *KeyedPool) Schedule(key string, task PoolTask) bool {
+	return kp.schedule(context.Background(), key, task)
+}
+
+// Schedule that gives up waiting for room in the key's queue once ctx is done
+func (kp *KeyedPool) schedule(ctx context.Context, key string, task PoolTask) bool {
+	kp.Lock()
+
+	for {
+		queue, ok := kp.queues[key]
+
+		if !ok {
+			queue = &keyedQueue{tasks: []PoolTask{task}}
+			kp.queues[key] = queue
+			kp.Unlock()
+
+			return kp.start(ctx, key, queue)
+		}
+
+		// A runner is already draining this key
+		if kp.limit <= 0 || len(queue.tasks) < kp.limit {
+			queue.tasks = append(queue.tasks, task)
+			kp.Unlock()
+			return true
+		}
+
+		if kp.pool.rejectionPolicy() == RejectDrop || ctx.Err() != nil {
+			kp.rejected++
+			kp.Unlock()
+			log.Printf("Queue for %s is full. Dropping task", key)
+			return false
+		}
+
+		kp.wait(ctx)
+	}
+}
+
+// Waits for a queue to shrink or ctx to be done. Must be called while
+// holding the lock.
+func (kp *KeyedPool) wait(ctx context.Context) {
+	stop := context.AfterFunc(ctx, func() {
+		kp.Lock()
+		kp.space.Broadcast()
+		kp.Unlock()
+	})
+
+	kp.space.Wait()
+	stop()
+}
+
+// Schedules a runner for the key's queue. If the pool rejects it the queue is
+// dropped so the next task for the key starts a new runner.
+func (kp *KeyedPool) start(ctx context.Context, key string, queue *keyedQueue) bool {
+	scheduled := kp.pool.schedule(ctx, func() {
+		kp.run(key, queue)
+	})
+
+	if scheduled {
+		return true
+	}
+
+	kp.Lock()
+	defer kp.Unlock()
+
+	if kp.queues[key] == queue {
+		delete(kp.queues, key)
+	}
+
+	kp.rejected += uint64(len(queue.tasks))
+	queue.tasks = nil
+	kp.space.Broadcast()
+
+	return false
+}
+
+// Number of tasks dropped because the pool was full or shut down
+func (kp *KeyedPool) Rejected() uint64 {
+	kp.Lock()
+	defer kp.Unlock()
+
+	return kp.rejected
+}
+
+// Number of keys with tasks running or waiting
+func (kp *KeyedPool) Len() int {
+	kp.Lock()
+	defer kp.Unlock()
+
+	return len(kp.queues)
+}
+
+func (kp *KeyedPool) run(key string, queue *keyedQueue) {
+	// If a task panics hand the rest of the queue to a new runner so the key
+	// is not stuck forever
+	defer func() {
+		if r := recover(); r != nil {
+			kp.start(context.Background(), key, queue)
+			panic(r)
+		}
+	}()
+
+	for {
+		kp.Lock()
+
+		if len(queue.tasks) == 0 {
+			delete(kp.queues, key)
+			kp.Unlock()
+			return
+		}
+
+		task := queue.tasks[0]
+		queue.tasks[0] = nil
+		queue.tasks = queue.tasks[1:]
+		kp.space.Broadcast()
+		kp.Unlock()
+
+		task()
+	}
+}
@@ -0,0 +1,198 @@
+package gosock
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestKeyedPoolOrder(t *testing.T) {
+	kp := NewKeyedPool(NewPool(10, 4, time.Second))
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	got := map[string][]int{}
+
+	for i := 0; i < 100; i++ {
+		for _, key := range []string{"a", "b", "c"} {
+			i, key := i, key
+			wg.Add(1)
+
+			kp.Schedule(key, func() {
+				defer wg.Done()
+
+				mu.Lock()
+				got[key] = append(got[key], i)
+				mu.Unlock()
+			})
+		}
+	}
+
+	wg.Wait()
+
+	for key, order := range got {
+		for i, v := range order {
+			if v != i {
+				t.Fatalf("Tasks for %s ran out of order. Got %v", key, order)
+			}
+		}
+	}
+
+	// Runner removes the key after its queue drains
+	deadline := time.Now().Add(time.Second)
+
+	for kp.Len() != 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	if kp.Len() != 0 {
+		t.Errorf("Expected no pending keys. Got %d", kp.Len())
+	}
+}
+
+func TestKeyedPoolPanicContinues(t *testing.T) {
+	pool := NewPool(10, 2, time.Second)
+	pool.OnPanic(func(*PanicReport) {})
+	kp := NewKeyedPool(pool)
+
+	done := make(chan struct{})
+
+	kp.Schedule("a", func() { panic("boom") })
+	kp.Schedule("a", func() { close(done) })
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Errorf("Task after a panic should still run")
+	}
+}
+
+func TestKeyedPoolRecoversFromRejection(t *testing.T) {
+	pool := NewPool(1, 1, time.Second)
+	pool.SetRejectionPolicy(RejectDrop)
+	kp := NewKeyedPool(pool)
+
+	block := fillPool(t, pool)
+
+	kp.Schedule("a", func() {
+		t.Errorf("Rejected task should not run")
+	})
+
+	if kp.Len() != 0 {
+		t.Errorf("Rejected key should not keep a queue. Got %d keys", kp.Len())
+	}
+
+	if kp.Rejected() != 1 {
+		t.Errorf("Expected 1 rejected task. Got %d", kp.Rejected())
+	}
+
+	close(block)
+
+	// Wait for the worker to drain the filler tasks
+	deadline := time.Now().Add(time.Second)
+
+	for pool.Stats().Queued != 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	done := make(chan struct{})
+	kp.Schedule("a", func() { close(done) })
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Errorf("Key should accept tasks again after a rejection")
+	}
+}
+
+func TestKeyedPoolQueueLimit(t *testing.T) {
+	pool := NewPool(10, 2, time.Second)
+	pool.SetRejectionPolicy(RejectDrop)
+
+	kp := NewKeyedPool(pool)
+	kp.SetQueueLimit(2)
+
+	block := make(chan struct{})
+	defer close(block)
+
+	// The first task holds the runner so later tasks wait in the queue
+	started := make(chan struct{})
+	kp.Schedule("a", func() { close(started); <-block })
+	<-started
+
+	for i := 0; i < 2; i++ {
+		if !kp.Schedule("a", func() {}) {
+			t.Fatalf("Task %d should fit in the queue", i+1)
+		}
+	}
+
+	if kp.Schedule("a", func() {}) {
+		t.Errorf("Task over the queue limit should be dropped")
+	}
+
+	if kp.Rejected() != 1 {
+		t.Errorf("Dropped task should be counted. Got %d", kp.Rejected())
+	}
+
+	// Other keys have their own queues
+	done := make(chan struct{})
+
+	if !kp.Schedule("b", func() { close(done) }) {
+		t.Errorf("Full queue for a should not affect b")
+	}
+
+	<-done
+}
+
+func TestKeyedPoolQueueLimitBlocks(t *testing.T) {
+	kp := NewKeyedPool(NewPool(10, 2, time.Second))
+	kp.SetQueueLimit(1)
+
+	block := make(chan struct{})
+	ran := make(chan int, 3)
+
+	started := make(chan struct{})
+	kp.Schedule("a", func() { close(started); <-block; ran <- 1 })
+	<-started
+	kp.Schedule("a", func() { ran <- 2 })
+
+	scheduled := make(chan bool, 1)
+
+	go func() { scheduled <- kp.Schedule("a", func() { ran <- 3 }) }()
+
+	select {
+	case <-scheduled:
+		t.Fatalf("Schedule should wait while the key's queue is full")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(block)
+
+	if !<-scheduled {
+		t.Fatalf("Schedule should succeed once the queue has room")
+	}
+
+	for want := 1; want <= 3; want++ {
+		if got := <-ran; got != want {
+			t.Errorf("Expected task %d. Got %d", want, got)
+		}
+	}
+
+	// Waiting gives up once the context is done
+	block = make(chan struct{})
+	defer close(block)
+
+	started = make(chan struct{})
+	kp.Schedule("a", func() { close(started); <-block })
+	<-started
+	kp.Schedule("a", func() {})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() { scheduled <- kp.schedule(ctx, "a", func() {}) }()
+	cancel()
+
+	if <-scheduled {
+		t.Errorf("Schedule should drop the task once the context is done")
+	}
+}
@@ -0,0 +1,140 @@
+package gosock
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+var (
+	ErrMessageTooBig     = errors.New("Message too big")
+	ErrMessageTooDeep    = errors.New("Message nested too deeply")
+	ErrChannelTooLong    = errors.New("Channel name too long")
+	ErrEventTooLong      = errors.New("Event name too long")
+	ErrReservedEventName = errors.New("Unknown reserved event")
+)
+
+// Limits applied to every message a client sends. Messages larger than
+// MaxMessageSize close the connection with 1009. Other violations are
+// answered with an error event and the message is dropped. Zero disables a
+// limit.
+type MessageLimits struct {
+	// Bytes in a single message across all of its frames
+	MaxMessageSize int64
+	// Nesting of objects and arrays in a message
+	MaxDepth int
+	// Bytes in the channel name
+	MaxChannelLength int
+	// Bytes in the event name
+	MaxEventLength int
+}
+
+var DefaultMessageLimits = MessageLimits{
+	MaxMessageSize:   1 << 20,
+	MaxDepth:         32,
+	MaxChannelLength: 256,
+	MaxEventLength:   128,
+}
+
+// Reserved events clients are allowed to send
+var clientEvents = map[string]bool{
+	JoinEventName:   true,
+	LeaveEventName:  true,
+	ResumeEventName: true,
+	AuthEventName:   true,
+	ReauthEventName: true,
+}
+
+// Sets the limits applied to incoming messages. Defaults to
+// DefaultMessageLimits. Connections keep the limits that were set when they
+// connected.
+func (h *Hub) MessageLimits(limits MessageLimits) {
+	h.Lock()
+	defer h.Unlock()
+
+	h.limits = limits
+}
+
+// Reads a whole message from r. Returns ErrMessageTooBig as soon as more
+// than max bytes have been read so oversized messages are never fully
+// buffered.
+func readMessage(r io.Reader, max int64) ([]byte, error) {
+	if max <= 0 {
+		return io.ReadAll(r)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r, max+1))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(data)) > max {
+		return nil, ErrMessageTooBig
+	}
+
+	return data, nil
+}
+
+// Checks a decoded message against the limits. Data is the raw message used
+// to check nesting depth.
+func (l MessageLimits) validate(data []byte, msg *Message) error {
+	if l.MaxDepth > 0 && jsonDepth(data) > l.MaxDepth {
+		return fmt.Errorf("%w: max depth is %d", ErrMessageTooDeep, l.MaxDepth)
+	}
+
+	if l.MaxChannelLength > 0 && len(msg.Channel) > l.MaxChannelLength {
+		return fmt.Errorf("%w: max length is %d", ErrChannelTooLong, l.MaxChannelLength)
+	}
+
+	if l.MaxEventLength > 0 && len(msg.Event) > l.MaxEventLength {
+		return fmt.Errorf("%w: max length is %d", ErrEventTooLong, l.MaxEventLength)
+	}
+
+	if isReservedEvent(msg.Event) && !clientEvents[msg.Event] {
+		return fmt.Errorf("%w %s", ErrReservedEventName, msg.Event)
+	}
+
+	return nil
+}
+
+func isReservedEvent(event string) bool {
+	return len(event) > 4 && strings.HasPrefix(event, "__") && strings.HasSuffix(event, "__")
+}
+
+// Deepest nesting of objects and arrays in a JSON document
+func jsonDepth(data []byte) int {
+	depth, max := 0, 0
+	inString, escaped := false, false
+
+	for _, c := range data {
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+
+			continue
+		}
+
+		switch c {
+		case '"':
+			inString = true
+		case '{', '[':
+			depth++
+
+			if depth > max {
+				max = depth
+			}
+		case '}', ']':
+			depth--
+		}
+	}
+
+	return max
+}
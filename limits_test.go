@@ -0,0 +1,83 @@
+package gosock
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestJsonDepth(t *testing.T) {
+	tests := []struct {
+		data string
+		want int
+	}{
+		{`"flat"`, 0},
+		{`{"a":1}`, 1},
+		{`{"a":[{"b":2}]}`, 3},
+		{`{"a":"{[{[not nested]}]}"}`, 1},
+		{`{"a":"escaped \" {[["}`, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.data, func(t *testing.T) {
+			if got := jsonDepth([]byte(tt.data)); got != tt.want {
+				t.Errorf("got %d, wanted %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMessageLimitsValidate(t *testing.T) {
+	limits := MessageLimits{
+		MaxDepth:         2,
+		MaxChannelLength: 10,
+		MaxEventLength:   8,
+	}
+
+	tests := []struct {
+		name string
+		data string
+		msg  Message
+		err  error
+	}{
+		{"valid", `{"payload":{"a":1}}`, Message{Channel: "chat.1", Event: "chat"}, nil},
+		{"join", `{}`, Message{Channel: "chat.1", Event: JoinEventName}, nil},
+		{"too deep", `{"payload":{"a":[1]}}`, Message{Channel: "chat.1", Event: "chat"}, ErrMessageTooDeep},
+		{"long channel", `{}`, Message{Channel: "chat.12345678", Event: "chat"}, ErrChannelTooLong},
+		{"long event", `{}`, Message{Channel: "chat.1", Event: "chatting!"}, ErrEventTooLong},
+		{"reserved", `{}`, Message{Channel: "chat.1", Event: "__x__"}, ErrReservedEventName},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := limits.validate([]byte(tt.data), &tt.msg)
+
+			if !errors.Is(err, tt.err) {
+				t.Errorf("got %v, wanted %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestReadMessageTooBig(t *testing.T) {
+	if _, err := readMessage(strings.NewReader("12345"), 5); err != nil {
+		t.Errorf("Message at the limit should be read. Got %s", err)
+	}
+
+	if _, err := readMessage(strings.NewReader("123456"), 5); !errors.Is(err, ErrMessageTooBig) {
+		t.Errorf("Message over the limit should return ErrMessageTooBig. Got %v", err)
+	}
+}
+
+func TestConnKeepsLimits(t *testing.T) {
+	hub := makeHub()
+	hub.MessageLimits(MessageLimits{MaxMessageSize: 16})
+
+	conn := makeDrainedConn(t, hub, "test")
+
+	hub.MessageLimits(MessageLimits{MaxMessageSize: 32})
+
+	if conn.limits.MaxMessageSize != 16 {
+		t.Errorf("Connection should keep the limits it was created with. Got %d", conn.limits.MaxMessageSize)
+	}
+}
@@ -0,0 +1,149 @@
+package gosock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+const defaultHeartbeatInterval = time.Second * 10
+
+// Membership keeps track of which connections are members of which channels
+// across every node in a cluster. Each node only knows about its own
+// connections so channel member counts need to come from a shared registry.
+type Membership interface {
+	// Adds a connection on a node as a member of a channel
+	Add(ctx context.Context, node string, path string, connId string) error
+
+	// Removes a connection on a node from a channel
+	Remove(ctx context.Context, node string, path string, connId string) error
+
+	// Returns the number of members of a channel across all nodes
+	Count(ctx context.Context, path string) (int, error)
+
+	// Marks a node as alive
+	Heartbeat(ctx context.Context, node string) error
+
+	// Removes every membership belonging to nodes that have not sent a
+	// heartbeat within ttl
+	Prune(ctx context.Context, ttl time.Duration) error
+}
+
+// MemoryMembership is a Membership that lives in process. It is the default
+// for a Hub and is only cluster-wide when a single node is running.
+type MemoryMembership struct {
+	sync.RWMutex
+
+	// path -> conn id -> node
+	members map[string]map[string]string
+
+	// node -> last heartbeat
+	nodes map[string]time.Time
+}
+
+func NewMemoryMembership() *MemoryMembership {
+	return &MemoryMembership{
+		members: make(map[string]map[string]string),
+		nodes:   make(map[string]time.Time),
+	}
+}
+
+func (mm *MemoryMembership) Add(ctx context.Context, node string, path string, connId string) error {
+	mm.Lock()
+	defer mm.Unlock()
+
+	conns, ok := mm.members[path]
+
+	if !ok {
+		conns = make(map[string]string)
+		mm.members[path] = conns
+	}
+
+	conns[connId] = node
+
+	return nil
+}
+
+func (mm *MemoryMembership) Remove(ctx context.Context, node string, path string, connId string) error {
+	mm.Lock()
+	defer mm.Unlock()
+
+	conns, ok := mm.members[path]
+
+	if !ok {
+		return nil
+	}
+
+	delete(conns, connId)
+
+	if len(conns) == 0 {
+		delete(mm.members, path)
+	}
+
+	return nil
+}
+
+func (mm *MemoryMembership) Count(ctx context.Context, path string) (int, error) {
+	mm.RLock()
+	defer mm.RUnlock()
+
+	return len(mm.members[path]), nil
+}
+
+func (mm *MemoryMembership) Heartbeat(ctx context.Context, node string) error {
+	mm.Lock()
+	defer mm.Unlock()
+
+	mm.nodes[node] = time.Now()
+
+	return nil
+}
+
+func (mm *MemoryMembership) Prune(ctx context.Context, ttl time.Duration) error {
+	mm.Lock()
+	defer mm.Unlock()
+
+	deadline := time.Now().Add(-ttl)
+	dead := make(map[string]bool)
+
+	for node, lastSeen := range mm.nodes {
+		if lastSeen.Before(deadline) {
+			dead[node] = true
+			delete(mm.nodes, node)
+		}
+	}
+
+	if len(dead) == 0 {
+		return nil
+	}
+
+	for path, conns := range mm.members {
+		for connId, node := range conns {
+			if dead[node] {
+				delete(conns, connId)
+			}
+		}
+
+		if len(conns) == 0 {
+			delete(mm.members, path)
+		}
+	}
+
+	return nil
+}
+
+func newNodeId() string {
+	return randomHex(8)
+}
+
+func randomHex(size int) string {
+	b := make([]byte, size)
+
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+
+	return hex.EncodeToString(b)
+}
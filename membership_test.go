@@ -0,0 +1,109 @@
+package gosock
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryMembershipCount(t *testing.T) {
+	ctx := context.Background()
+	mm := NewMemoryMembership()
+
+	mm.Add(ctx, "node-a", "chat.1", "conn-1")
+	mm.Add(ctx, "node-b", "chat.1", "conn-2")
+	mm.Add(ctx, "node-b", "chat.2", "conn-3")
+
+	count, _ := mm.Count(ctx, "chat.1")
+
+	if count != 2 {
+		t.Errorf("Count should equal 2. Got %d", count)
+	}
+
+	mm.Remove(ctx, "node-a", "chat.1", "conn-1")
+
+	count, _ = mm.Count(ctx, "chat.1")
+
+	if count != 1 {
+		t.Errorf("Count should equal 1 after remove. Got %d", count)
+	}
+}
+
+func TestMemoryMembershipPrune(t *testing.T) {
+	ctx := context.Background()
+	mm := NewMemoryMembership()
+
+	mm.Heartbeat(ctx, "node-a")
+	mm.Heartbeat(ctx, "node-b")
+
+	mm.Add(ctx, "node-a", "chat.1", "conn-1")
+	mm.Add(ctx, "node-b", "chat.1", "conn-2")
+
+	// node-b stops sending heartbeats
+	mm.nodes["node-b"] = time.Now().Add(-time.Minute)
+
+	mm.Prune(ctx, time.Second*30)
+
+	count, _ := mm.Count(ctx, "chat.1")
+
+	if count != 1 {
+		t.Errorf("Stale node members should be pruned. Got count %d", count)
+	}
+}
+
+// A member on another node keeps the channel open after the last local member
+// leaves. The heartbeat closes it once that node's members are pruned.
+func TestRemoteMemberKeepsChannelOpen(t *testing.T) {
+	ctx := context.Background()
+	hub := makeHub()
+	hub.Start()
+
+	mm := NewMemoryMembership()
+	hub.AddMembership(mm)
+
+	closed := make(chan struct{}, 1)
+
+	hub.Channel("room.{id}", func(r *Router) {
+		r.On(r.Join(func(ctx context.Context, c *Channel) error { return nil }))
+		r.OnClose(func(ctx context.Context, c *Channel) error {
+			closed <- struct{}{}
+			return nil
+		})
+	})
+
+	mm.Heartbeat(ctx, "remote-node")
+	mm.Add(ctx, "remote-node", "room.1", "remote-conn")
+
+	conn := makeDrainedConn(t, hub, "local")
+	channel, err := hub.Join(conn, "room.1")
+
+	if err != nil {
+		t.Fatalf("Join failed: %s", err)
+	}
+
+	channel.removeConnection(conn)
+	channel.tryClose()
+
+	if _, err := hub.Lookup("room.1"); err != nil {
+		t.Fatalf("Channel should stay open while another node has members. Got %v", err)
+	}
+
+	if count := channel.MemberCount(); count != 1 {
+		t.Errorf("MemberCount should include the remote member. Got %d", count)
+	}
+
+	// The remote node stops sending heartbeats
+	mm.Lock()
+	mm.nodes["remote-node"] = time.Now().Add(-time.Minute)
+	mm.Unlock()
+
+	hub.beat(time.Second)
+
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatalf("Heartbeat should close the channel once the remote members are pruned")
+	}
+
+	waitForChannels(t, hub, 0)
+}
@@ -4,12 +4,36 @@ import (
 	"encoding/json"
 )
 
+// Events sent between clients and the hub
+const (
+	JoinEventName   = "__join__"
+	LeaveEventName  = "__leave__"
+	JoinedEventName = "__joined__"
+	KickedEventName = "__kicked__"
+
+	RateLimitedEventName = "__rate_limited__"
+
+	AuthEventName          = "__auth__"
+	ReauthEventName        = "__reauth__"
+	AuthenticatedEventName = "__authenticated__"
+	AuthFailedEventName    = "__auth_failed__"
+
+	ConnectedEventName    = "__connected__"
+	SessionEventName      = "__session__"
+	ResumeEventName       = "__resume__"
+	ResumedEventName      = "__resumed__"
+	ResumeFailedEventName = "__resume_failed__"
+
+	ErrorEventName = "error"
+)
+
 const (
-	joinEventName       = "__join__"
 	beforeJoinEventName = "__before_join__"
-	leaveEventName      = "__leave__"
 	afterLeaveEventName = "__after_leave__"
 	disconnectEventName = "__disconnect__"
+
+	createEventName = "__create__"
+	closeEventName  = "__close__"
 )
 
 type Message struct {
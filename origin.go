@@ -0,0 +1,172 @@
+package gosock
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+var (
+	ErrOriginNotAllowed     = errors.New("Origin not allowed")
+	ErrInvalidCSRFToken     = errors.New("Invalid CSRF token")
+	ErrInvalidOriginPattern = errors.New("Invalid origin pattern")
+)
+
+// Reports whether a websocket upgrade request's origin is allowed
+type OriginChecker func(r *http.Request) bool
+
+// Validates a CSRF token on a websocket upgrade request. Returning an error
+// rejects the upgrade with a 403.
+type CSRFChecker func(r *http.Request) error
+
+// Allows upgrades from the given origins. Origins are matched against the
+// request's Origin header and may start their host with `*.` to match
+// subdomains, such as `https://*.example.com`. Everything else is compared
+// exactly. A single `*` allows every origin. Panics if a `*` is used anywhere
+// else.
+//
+// When no origins or origin checker are configured only requests whose
+// origin matches the request host are allowed. Requests without an Origin
+// header, which browsers always send, are allowed.
+func (h *Hub) AllowOrigins(origins ...string) {
+	h.Lock()
+	defer h.Unlock()
+
+	for _, origin := range origins {
+		if err := validateOriginPattern(origin); err != nil {
+			panic(err)
+		}
+
+		h.allowedOrigins = append(h.allowedOrigins, strings.ToLower(origin))
+	}
+}
+
+// Replaces the default origin check with a custom one. Allowed origins are
+// ignored when a checker is set.
+func (h *Hub) CheckOrigin(checker OriginChecker) {
+	h.Lock()
+	defer h.Unlock()
+
+	h.originChecker = checker
+}
+
+// Requires upgrade requests to pass a CSRF check
+func (h *Hub) CSRF(checker CSRFChecker) {
+	h.Lock()
+	defer h.Unlock()
+
+	h.csrfChecker = checker
+}
+
+// CSRFChecker using the double submit cookie pattern. The token in the
+// cookie must equal the token passed in the query string param.
+func DoubleSubmitCookie(cookie string, param string) CSRFChecker {
+	return func(r *http.Request) error {
+		c, err := r.Cookie(cookie)
+
+		if err != nil || c.Value == "" {
+			return ErrInvalidCSRFToken
+		}
+
+		token := r.URL.Query().Get(param)
+
+		if subtle.ConstantTimeCompare([]byte(c.Value), []byte(token)) != 1 {
+			return ErrInvalidCSRFToken
+		}
+
+		return nil
+	}
+}
+
+// Runs the origin and CSRF checks before a request is upgraded
+func (h *Hub) checkUpgrade(r *http.Request) error {
+	h.RLock()
+	originChecker := h.originChecker
+	allowed := h.allowedOrigins
+	csrfChecker := h.csrfChecker
+	h.RUnlock()
+
+	if originChecker == nil {
+		originChecker = func(r *http.Request) bool {
+			return checkOrigin(r, allowed)
+		}
+	}
+
+	if !originChecker(r) {
+		return ErrOriginNotAllowed
+	}
+
+	if csrfChecker != nil {
+		return csrfChecker(r)
+	}
+
+	return nil
+}
+
+func checkOrigin(r *http.Request, allowed []string) bool {
+	origin := r.Header.Get("Origin")
+
+	if origin == "" {
+		return true
+	}
+
+	origin = strings.ToLower(origin)
+
+	if len(allowed) == 0 {
+		u, err := url.Parse(origin)
+
+		return err == nil && strings.EqualFold(u.Host, r.Host)
+	}
+
+	for _, pattern := range allowed {
+		if pattern == "*" || pattern == origin || matchWildcardOrigin(pattern, origin) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Wildcards are only allowed as the whole first label of the host, as in
+// `https://*.example.com`
+func validateOriginPattern(pattern string) error {
+	if pattern == "*" || !strings.Contains(pattern, "*") {
+		return nil
+	}
+
+	prefix, suffix, _ := strings.Cut(pattern, "*")
+
+	if !strings.HasSuffix(prefix, "://") || strings.Contains(prefix[:len(prefix)-3], "/") ||
+		!strings.HasPrefix(suffix, ".") || strings.Contains(suffix, "*") {
+		return fmt.Errorf("%w: %q. Only a leading * subdomain label is allowed", ErrInvalidOriginPattern, pattern)
+	}
+
+	return nil
+}
+
+// Matches an origin against a pattern whose leading `*` label stands for one
+// or more subdomain labels
+func matchWildcardOrigin(pattern string, origin string) bool {
+	if validateOriginPattern(pattern) != nil {
+		return false
+	}
+
+	prefix, suffix, ok := strings.Cut(pattern, "*")
+
+	if !ok || len(origin) <= len(prefix)+len(suffix) {
+		return false
+	}
+
+	if !strings.HasPrefix(origin, prefix) || !strings.HasSuffix(origin, suffix) {
+		return false
+	}
+
+	subdomain := origin[len(prefix) : len(origin)-len(suffix)]
+
+	return strings.IndexFunc(subdomain, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '.')
+	}) < 0
+}
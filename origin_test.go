@@ -0,0 +1,126 @@
+package gosock
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckOrigin(t *testing.T) {
+	tests := []struct {
+		name    string
+		origin  string
+		allowed []string
+		want    bool
+	}{
+		{"no origin", "", nil, true},
+		{"same host", "https://example.com", nil, true},
+		{"other host", "https://evil.com", nil, false},
+		{"exact", "https://app.example.com", []string{"https://app.example.com"}, true},
+		{"case", "https://App.Example.com", []string{"https://app.example.com"}, true},
+		{"wildcard", "https://a.example.com", []string{"https://*.example.com"}, true},
+		{"wildcard scheme", "http://a.example.com", []string{"https://*.example.com"}, false},
+		{"wildcard suffix", "https://example.com.evil.com", []string{"https://*.example.com"}, false},
+		{"wildcard nested", "https://a.b.example.com", []string{"https://*.example.com"}, true},
+		{"wildcard empty", "https://.example.com", []string{"https://*.example.com"}, false},
+		{"wildcard path", "https://evil.com/.example.com", []string{"https://*.example.com"}, false},
+		{"wildcard port", "https://a.example.com:8080", []string{"https://*.example.com:8080"}, true},
+		{"brackets literal", "https://a.example.com", []string{"https://[a-z].example.com"}, false},
+		{"question literal", "https://a.example.com", []string{"https://?.example.com"}, false},
+		{"trailing wildcard", "https://app.evil.com", []string{"https://app.*"}, false},
+		{"any", "https://evil.com", []string{"*"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "https://example.com/", nil)
+
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+
+			if got := checkOrigin(r, tt.allowed); got != tt.want {
+				t.Errorf("got %v, wanted %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateOriginPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		valid   bool
+	}{
+		{"*", true},
+		{"https://app.example.com", true},
+		{"https://*.example.com", true},
+		{"https://*.example.com:8080", true},
+		{"https://app.*", false},
+		{"https://a*.example.com", false},
+		{"https://*example.com", false},
+		{"*.example.com", false},
+		{"https://*.*.example.com", false},
+		{"https://example.com/*", false},
+	}
+
+	for _, tt := range tests {
+		err := validateOriginPattern(tt.pattern)
+
+		if (err == nil) != tt.valid {
+			t.Errorf("Pattern %s valid should be %t. Got %v", tt.pattern, tt.valid, err)
+		}
+
+		if err != nil && !errors.Is(err, ErrInvalidOriginPattern) {
+			t.Errorf("Expected %s. Got %s", ErrInvalidOriginPattern, err)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("AllowOrigins should panic on an invalid pattern")
+		}
+	}()
+
+	makeHub().AllowOrigins("https://app.*")
+}
+
+func TestUpgradeRejected(t *testing.T) {
+	hub := makeHub()
+	hub.CSRF(DoubleSubmitCookie("csrf", "csrf"))
+	hub.Start()
+
+	tests := []struct {
+		name   string
+		origin string
+		cookie string
+		param  string
+		err    error
+	}{
+		{"bad origin", "https://evil.com", "token", "token", ErrOriginNotAllowed},
+		{"missing csrf", "https://example.com", "", "", ErrInvalidCSRFToken},
+		{"wrong csrf", "https://example.com", "token", "other", ErrInvalidCSRFToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "https://example.com/?csrf="+tt.param, nil)
+			r.Header.Set("Origin", tt.origin)
+
+			if tt.cookie != "" {
+				r.AddCookie(&http.Cookie{Name: "csrf", Value: tt.cookie})
+			}
+
+			if err := hub.checkUpgrade(r); !errors.Is(err, tt.err) {
+				t.Errorf("got %v, wanted %v", err, tt.err)
+			}
+
+			w := httptest.NewRecorder()
+			hub.ServeHTTP(w, r)
+
+			if w.Code != http.StatusForbidden {
+				t.Errorf("Status should be 403. Got %d", w.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package gosock
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"runtime/debug"
+)
+
+var ErrInternal = errors.New("Internal error")
+
+// Describes a task that panicked. Conn, channel and event are empty for
+// tasks that were not handling a message.
+type PanicReport struct {
+	Value   interface{}
+	Stack   []byte
+	ConnId  string
+	Channel string
+	Event   string
+}
+
+func (pr *PanicReport) String() string {
+	if pr.ConnId == "" {
+		return fmt.Sprintf("panic: %v\n%s", pr.Value, pr.Stack)
+	}
+
+	return fmt.Sprintf(
+		"panic handling %s on %s for connection %s: %v\n%s",
+		pr.Event,
+		pr.Channel,
+		pr.ConnId,
+		pr.Value,
+		pr.Stack,
+	)
+}
+
+// Passes the report to the pool's panic handler, or logs it if there is none
+func (p *Pool) reportPanic(report *PanicReport) {
+	if p.panicHandler == nil {
+		log.Print(report)
+		return
+	}
+
+	p.panicHandler(report)
+}
+
+// Runs a task, recovering from any panic so the worker keeps running
+func (p *Pool) run(task PoolTask) {
+	defer func() {
+		if r := recover(); r != nil {
+			p.reportPanic(&PanicReport{
+				Value: r,
+				Stack: debug.Stack(),
+			})
+		}
+	}()
+
+	task()
+}
+
+// Deferred by tasks handling a message. Reports the panic with the message's
+// details and tells the client the event failed.
+func (h *Hub) recoverMessage(conn *Conn, msg *Message) {
+	r := recover()
+
+	if r == nil {
+		return
+	}
+
+	h.pool.reportPanic(&PanicReport{
+		Value:   r,
+		Stack:   debug.Stack(),
+		ConnId:  conn.Id,
+		Channel: msg.Channel,
+		Event:   msg.Event,
+	})
+
+	conn.sendResponse(&Response{
+		Channel: msg.Channel,
+		Event:   ErrorEventName,
+		Payload: J{"error": ErrInternal.Error(), "event": msg.Event},
+	})
+}
+
+// Deferred by tasks running a lifecycle handler for a connection that is
+// gone, so there is no one to reply to
+func (h *Hub) recoverLifecycle(conn *Conn, channel *Channel, event string) {
+	r := recover()
+
+	if r == nil {
+		return
+	}
+
+	h.pool.reportPanic(&PanicReport{
+		Value:   r,
+		Stack:   debug.Stack(),
+		ConnId:  conn.Id,
+		Channel: channel.path,
+		Event:   event,
+	})
+}
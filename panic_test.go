@@ -0,0 +1,96 @@
+package gosock
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gobwas/ws/wsutil"
+)
+
+func TestPoolRecoversPanicPerTask(t *testing.T) {
+	pool := NewPool(10, 1, time.Second)
+	reports := make(chan *PanicReport, 1)
+
+	pool.OnPanic(func(report *PanicReport) {
+		reports <- report
+	})
+
+	done := make(chan struct{})
+
+	pool.Schedule(func() { panic("boom") })
+	pool.Schedule(func() { close(done) })
+
+	select {
+	case report := <-reports:
+		if report.Value != "boom" {
+			t.Errorf("Expected panic value boom. Got %v", report.Value)
+		}
+
+		if len(report.Stack) == 0 {
+			t.Errorf("Expected report to include a stack trace")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Panic handler was not called")
+	}
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Errorf("Worker should keep running after a panic")
+	}
+
+	if pool.WorkerCount() != 1 {
+		t.Errorf("Expected 1 worker. Got %d", pool.WorkerCount())
+	}
+}
+
+func TestHubRecoversHandlerPanic(t *testing.T) {
+	conn, client := makeTestConn(t)
+	hub := conn.hub
+
+	reports := make(chan *PanicReport, 1)
+
+	hub.pool.OnPanic(func(report *PanicReport) {
+		reports <- report
+	})
+
+	hub.Channel("room", func(r *Router) {
+		r.On(r.Join(func(ctx context.Context, c *Channel) error {
+			panic("boom")
+		}))
+	})
+
+	hub.dispatch(conn, &Message{Channel: "room", Event: JoinEventName})
+
+	var response struct {
+		Channel string `json:"channel"`
+		Event   string `json:"event"`
+		Payload J      `json:"payload"`
+	}
+
+	// Skip anything the join wrote before the handler panicked
+	for response.Event != ErrorEventName {
+		client.SetReadDeadline(time.Now().Add(time.Second))
+		data, err := wsutil.ReadServerText(client)
+
+		if err != nil {
+			t.Fatalf("Expected an error reply. Got %s", err)
+		}
+
+		if err := json.Unmarshal(data, &response); err != nil {
+			t.Fatalf("Could not decode reply. Got %s", err)
+		}
+	}
+
+	if response.Payload["error"] != ErrInternal.Error() {
+		t.Errorf("Expected internal error reply. Got %v", response.Payload)
+	}
+
+	report := <-reports
+
+	if report.ConnId != conn.Id || report.Channel != "room" || report.Event != JoinEventName {
+		t.Errorf("Expected report for test room %s. Got %s %s %s", JoinEventName, report.ConnId, report.Channel, report.Event)
+	}
+}
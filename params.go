@@ -22,6 +22,10 @@ func (p *Params) Add(key string, value string) {
 	*p = append(*p, param)
 }
 
+func (p *Params) pop() {
+	*p = (*p)[:len(*p)-1]
+}
+
 func (p *Params) Reset() {
 	*p = (*p)[0:0]
 }
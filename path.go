@@ -0,0 +1,134 @@
+package gosock
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrMissingParam = errors.New("missing param")
+	ErrInvalidParam = errors.New("invalid param")
+)
+
+// Escapes a value so it can be used as a single channel segment. Dots are
+// segment separators so they are percent encoded along with `%` itself.
+// Param values are unescaped when a channel is looked up.
+func EscapeSegment(value string) string {
+	if !strings.ContainsAny(value, ".%") {
+		return value
+	}
+
+	value = strings.ReplaceAll(value, "%", "%25")
+
+	return strings.ReplaceAll(value, ".", "%2E")
+}
+
+// Reverses EscapeSegment
+func UnescapeSegment(segment string) string {
+	if !strings.Contains(segment, "%") {
+		return segment
+	}
+
+	var b strings.Builder
+
+	for i := 0; i < len(segment); i++ {
+		if segment[i] == '%' && i+3 <= len(segment) {
+			switch strings.ToUpper(segment[i+1 : i+3]) {
+			case "2E":
+				b.WriteByte('.')
+				i += 2
+				continue
+			case "25":
+				b.WriteByte('%')
+				i += 2
+				continue
+			}
+		}
+
+		b.WriteByte(segment[i])
+	}
+
+	return b.String()
+}
+
+// Builds a concrete channel name from a pattern by replacing each param with
+// its value in params. Values are escaped so they always stay in one segment
+// except for catch-all params which may span several. Optional params can be
+// left out.
+//
+//	BuildPath("chat.{channelId}", map[string]string{"channelId": "123"}) // chat.123
+func BuildPath(pattern string, params map[string]string) (string, error) {
+	if err := validatePattern(pattern); err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+
+	key := pattern
+
+	for {
+		start, end, param := getParam(key)
+
+		if start < 0 {
+			b.WriteString(key)
+			break
+		}
+
+		b.WriteString(key[:start])
+		key = key[end:]
+
+		optional := isOptionalParam(param)
+
+		if optional {
+			param = strings.TrimSuffix(param, "?}") + "}"
+		}
+
+		node := newParamNode(param)
+		val := params[node.getParamName()]
+
+		if val == "" {
+			if optional {
+				// Optional params are always last so drop the separator before it
+				return strings.TrimSuffix(b.String(), "."), nil
+			}
+
+			return "", fmt.Errorf("%w: %s for %q", ErrMissingParam, node.getParamName(), pattern)
+		}
+
+		if node.IsCatchAll() {
+			b.WriteString(val)
+			continue
+		}
+
+		if node.constraint != nil && !node.constraint.MatchString(val) {
+			return "", fmt.Errorf("%w: %s=%q does not match %s in %q", ErrInvalidParam, node.getParamName(), val, param, pattern)
+		}
+
+		b.WriteString(EscapeSegment(val))
+	}
+
+	return b.String(), nil
+}
+
+// Names of the params in a pattern in the order they appear
+func paramNames(pattern string) []string {
+	var names []string
+
+	key := pattern
+
+	for {
+		start, end, param := getParam(key)
+
+		if start < 0 || end < 0 {
+			return names
+		}
+
+		if isOptionalParam(param) {
+			param = strings.TrimSuffix(param, "?}") + "}"
+		}
+
+		names = append(names, newParamNode(param).getParamName())
+		key = key[end:]
+	}
+}
@@ -0,0 +1,76 @@
+package gosock
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestBuildPath(t *testing.T) {
+	tests := []struct {
+		pattern string
+		params  map[string]string
+		want    string
+		err     error
+	}{
+		{"chat.{channelId}", map[string]string{"channelId": "123"}, "chat.123", nil},
+		{"org.{orgId}.chat.{roomId}", map[string]string{"orgId": "1", "roomId": "2"}, "org.1.chat.2", nil},
+		{"chat.{channelId}", map[string]string{"channelId": "a.b"}, "chat.a%2Eb", nil},
+		{"chat.{channelId}", map[string]string{"channelId": "100%"}, "chat.100%25", nil},
+		{"files.{path...}", map[string]string{"path": "docs.report"}, "files.docs.report", nil},
+		{"doc.{id}.{page?}", map[string]string{"id": "42"}, "doc.42", nil},
+		{"doc.{id}.{page?}", map[string]string{"id": "42", "page": "7"}, "doc.42.7", nil},
+		{"doc.{id:int}", map[string]string{"id": "42"}, "doc.42", nil},
+		{"doc.{id:int}", map[string]string{"id": "abc"}, "", ErrInvalidParam},
+		{"chat.{channelId}", map[string]string{}, "", ErrMissingParam},
+		{"chat.{channelId", map[string]string{}, "", ErrInvalidRoute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			got, err := BuildPath(tt.pattern, tt.params)
+
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Error should be %v. Got %v", tt.err, err)
+			}
+
+			if got != tt.want {
+				t.Errorf("got %s, wanted %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEscapedParamLookup(t *testing.T) {
+	tree := NewTree()
+	router := NewRouter("chat.{channelId}", makeHub())
+
+	tree.Add(router.Pattern(), router)
+
+	for _, val := range []string{"a.b", "100%", "%2E"} {
+		t.Run(val, func(t *testing.T) {
+			path, err := router.Path(val)
+
+			if err != nil {
+				t.Fatalf("Path should not error: %s", err)
+			}
+
+			match, params := tree.Lookup(path)
+
+			if match == nil || match.Channel != router {
+				t.Fatalf("Built path %s should match router", path)
+			}
+
+			if got, _ := params.Get("channelId"); got != val {
+				t.Errorf("Param should be unescaped to %s. Got %s", val, got)
+			}
+		})
+	}
+}
+
+func TestRouterPathTooManyValues(t *testing.T) {
+	router := NewRouter("chat.{channelId}", makeHub())
+
+	if _, err := router.Path("1", "2"); !errors.Is(err, ErrInvalidParam) {
+		t.Errorf("Too many values should return ErrInvalidParam. Got %v", err)
+	}
+}
@@ -1,57 +1,274 @@
 package gosock
 
 import (
+	"context"
+	"errors"
 	"log"
+	"sync"
 	"sync/atomic"
 	"time"
 )
 
+var ErrPoolClosed = errors.New("Pool is closed")
+
 type PoolTask func()
 
-type PanicHandler func(interface{})
+// Called with the details of a task that panicked
+type PanicHandler func(*PanicReport)
+
+// What Schedule does with a task when every worker is busy and the queue is
+// full
+type RejectionPolicy uint8
+
+const (
+	// Wait until there is room in the queue
+	RejectBlock RejectionPolicy = iota
+	// Drop the task
+	RejectDrop
+	// Run the task on the caller's goroutine
+	RejectCallerRuns
+)
 
 type Pool struct {
+	// Guards jobs from being sent to after it is closed on shutdown
+	mu     sync.RWMutex
+	closed bool
+	// Closed on shutdown to wake callers blocked on a full queue
+	done chan struct{}
+	// Callers blocked on a full queue. Shutdown waits for them before
+	// closing jobs.
+	senders sync.WaitGroup
+
 	jobs     chan PoolTask
 	sem      chan struct{}
 	maxPools int
 	ttl      time.Duration
 
 	workerCount int32
+	rejected    atomic.Uint64
+	workers     sync.WaitGroup
 
+	policy       RejectionPolicy
 	panicHandler PanicHandler
 }
 
 func NewPool(queue, maxPools int, ttl time.Duration) *Pool {
 	return &Pool{
-		// This probably needs to be locked or atomic in some way
-		workerCount: 0,
 		// Amount of jobs that can be queued once maxPools is full
 		jobs: make(chan PoolTask, queue),
+		done: make(chan struct{}),
 		// Allows maxPools number of goroutines to spawn
-		sem: make(chan struct{}, maxPools),
-		ttl: ttl,
+		sem:      make(chan struct{}, maxPools),
+		maxPools: maxPools,
+		ttl:      ttl,
+	}
+}
+
+type PoolStats struct {
+	Workers    int32  `json:"workers"`
+	MaxWorkers int    `json:"maxWorkers"`
+	Queued     int    `json:"queued"`
+	QueueSize  int    `json:"queueSize"`
+	Rejected   uint64 `json:"rejected"`
+}
+
+func (p *Pool) Stats() PoolStats {
+	return PoolStats{
+		Workers:    p.WorkerCount(),
+		MaxWorkers: p.maxPools,
+		Queued:     len(p.jobs),
+		QueueSize:  cap(p.jobs),
+		Rejected:   p.Rejected(),
 	}
 }
 
 func (p *Pool) WorkerCount() int32 {
-	count := p.workerCount
+	return atomic.LoadInt32(&p.workerCount)
+}
 
-	return count
+// Number of tasks dropped by the rejection policy or rejected because the
+// pool was closed
+func (p *Pool) Rejected() uint64 {
+	return p.rejected.Load()
 }
 
+// Sets the handler called when a task panics. Panics are logged when no
+// handler is set. Either way the worker keeps running.
 func (p *Pool) OnPanic(handler PanicHandler) {
 	p.panicHandler = handler
 }
 
-func (p *Pool) Schedule(task PoolTask) {
+// Sets what Schedule does when the pool is full. Defaults to RejectBlock.
+func (p *Pool) SetRejectionPolicy(policy RejectionPolicy) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.policy = policy
+}
+
+func (p *Pool) rejectionPolicy() RejectionPolicy {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return p.policy
+}
+
+// Runs task on a worker. When every worker is busy and the queue is full the
+// pool's rejection policy decides what happens to it. Tasks scheduled after
+// Shutdown are dropped. Returns false if the task was dropped.
+func (p *Pool) Schedule(task PoolTask) bool {
+	return p.schedule(context.Background(), task)
+}
+
+// Schedule that gives up waiting for room in the queue once ctx is done. Used
+// by the hub so a read loop or channel writer only blocks for as long as the
+// connection it serves is alive.
+func (p *Pool) schedule(ctx context.Context, task PoolTask) bool {
+	p.mu.RLock()
+
+	if p.closed {
+		p.mu.RUnlock()
+		p.rejected.Add(1)
+		log.Printf("Dropping task scheduled on closed pool")
+		return false
+	}
+
+	if p.trySchedule(task) {
+		p.mu.RUnlock()
+		return true
+	}
+
+	switch p.policy {
+	case RejectDrop:
+		p.mu.RUnlock()
+		p.rejected.Add(1)
+		log.Printf("Pool is full. Dropping task")
+		return false
+
+	case RejectCallerRuns:
+		p.mu.RUnlock()
+		p.run(task)
+
+	default:
+		p.senders.Add(1)
+		p.mu.RUnlock()
+		defer p.senders.Done()
+
+		select {
+		case p.jobs <- task:
+		case <-p.done:
+			p.rejected.Add(1)
+			log.Printf("Dropping task scheduled on closed pool")
+			return false
+		case <-ctx.Done():
+			p.rejected.Add(1)
+			return false
+		}
+	}
+
+	return true
+}
+
+// Runs task on a worker if one is free or there is room in the queue.
+// Returns false without blocking otherwise.
+func (p *Pool) TrySchedule(task PoolTask) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.closed {
+		return false
+	}
+
+	return p.trySchedule(task)
+}
+
+// Runs task on a worker, waiting for room in the queue until ctx is done or
+// the pool shuts down
+func (p *Pool) ScheduleContext(ctx context.Context, task PoolTask) error {
+	p.mu.RLock()
+
+	if p.closed {
+		p.mu.RUnlock()
+		return ErrPoolClosed
+	}
+
+	if p.trySchedule(task) {
+		p.mu.RUnlock()
+		return nil
+	}
+
+	p.senders.Add(1)
+	p.mu.RUnlock()
+	defer p.senders.Done()
+
+	select {
+	case p.jobs <- task:
+		return nil
+	case <-p.done:
+		return ErrPoolClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Must be called while holding the read lock
+func (p *Pool) trySchedule(task PoolTask) bool {
 	select {
 	// If we can aquire the semaphore
 	case p.sem <- struct{}{}:
 		// Spawn new go routine
+		p.workers.Add(1)
 		go p.workTimeout(task)
+		return true
 	default:
-		// Otherwise just queue the task
-		p.jobs <- task
+	}
+
+	// Otherwise try to queue the task
+	select {
+	case p.jobs <- task:
+		return true
+	default:
+		return false
+	}
+}
+
+// Stops accepting tasks, runs every queued task and waits for workers to
+// exit. Returns ctx's error if it is done first, in which case remaining
+// tasks keep running in the background.
+func (p *Pool) Shutdown(ctx context.Context) error {
+	p.mu.Lock()
+
+	if p.closed {
+		p.mu.Unlock()
+		return ErrPoolClosed
+	}
+
+	p.closed = true
+	close(p.done)
+	p.mu.Unlock()
+
+	done := make(chan struct{})
+
+	go func() {
+		// Blocked callers return once done is closed. Closing jobs while
+		// they are still sending would panic.
+		p.senders.Wait()
+		close(p.jobs)
+
+		// Workers may have all timed out with tasks still queued
+		for job := range p.jobs {
+			p.run(job)
+		}
+
+		p.workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
 }
 
@@ -62,29 +279,20 @@ func (p *Pool) release() {
 type PoolHandlerInit func(*Pool)
 
 func (p *Pool) close() {
-	id := p.workerCount
-	atomic.AddInt32(&p.workerCount, -1)
+	id := atomic.AddInt32(&p.workerCount, -1) + 1
 	log.Printf("Closing worker %d", id)
 	p.release()
+	p.workers.Done()
 }
 
 func (p *Pool) workTimeout(task PoolTask) {
-	atomic.AddInt32(&p.workerCount, 1)
+	id := atomic.AddInt32(&p.workerCount, 1)
 
 	defer p.close()
-	defer func() {
-		if p.panicHandler == nil {
-			return
-		}
 
-		if r := recover(); r != nil {
-			p.panicHandler(r)
-		}
-	}()
-
-	log.Printf("Opening worker %d", p.workerCount)
+	log.Printf("Opening worker %d", id)
 
-	task()
+	p.run(task)
 
 	t := time.NewTimer(p.ttl)
 
@@ -95,9 +303,20 @@ func (p *Pool) workTimeout(task PoolTask) {
 		case <-t.C:
 			return
 
-		case job := <-p.jobs:
-			t.Stop()
-			job()
+		case job, ok := <-p.jobs:
+			// Pool has been shut down and the queue is drained
+			if !ok {
+				return
+			}
+
+			if !t.Stop() {
+				select {
+				case <-t.C:
+				default:
+				}
+			}
+
+			p.run(job)
 			t.Reset(p.ttl)
 		}
 	}
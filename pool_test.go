@@ -0,0 +1,172 @@
+package gosock
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Fills the pool's only worker and queue slot, returning a channel that
+// releases the worker
+func fillPool(t *testing.T, pool *Pool) chan struct{} {
+	t.Helper()
+
+	block := make(chan struct{})
+
+	if !pool.TrySchedule(func() { <-block }) {
+		t.Fatalf("First task should start a worker")
+	}
+
+	if !pool.TrySchedule(func() {}) {
+		t.Fatalf("Second task should be queued")
+	}
+
+	return block
+}
+
+func TestTryScheduleFull(t *testing.T) {
+	pool := NewPool(1, 1, time.Second)
+	block := fillPool(t, pool)
+	defer close(block)
+
+	if pool.TrySchedule(func() {}) {
+		t.Errorf("TrySchedule should return false when the pool is full")
+	}
+}
+
+func TestScheduleContextTimeout(t *testing.T) {
+	pool := NewPool(1, 1, time.Second)
+	block := fillPool(t, pool)
+	defer close(block)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+
+	if err := pool.ScheduleContext(ctx, func() {}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("ScheduleContext should time out when the pool is full. Got %v", err)
+	}
+}
+
+func TestRejectionPolicy(t *testing.T) {
+	pool := NewPool(1, 1, time.Second)
+	block := fillPool(t, pool)
+	defer close(block)
+
+	pool.SetRejectionPolicy(RejectDrop)
+	pool.Schedule(func() {})
+
+	if pool.Rejected() != 1 {
+		t.Errorf("Dropped task should be counted. Got %d", pool.Rejected())
+	}
+
+	pool.SetRejectionPolicy(RejectCallerRuns)
+
+	ran := false
+	pool.Schedule(func() { ran = true })
+
+	if !ran {
+		t.Errorf("Task should run on the caller when the pool is full")
+	}
+}
+
+func TestShutdownDrainsQueue(t *testing.T) {
+	pool := NewPool(10, 1, time.Second)
+
+	var count atomic.Int32
+	block := make(chan struct{})
+
+	pool.Schedule(func() { <-block })
+
+	for i := 0; i < 10; i++ {
+		pool.Schedule(func() { count.Add(1) })
+	}
+
+	close(block)
+
+	if err := pool.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown should not fail: %s", err)
+	}
+
+	if count.Load() != 10 {
+		t.Errorf("Every queued task should run before shutdown returns. Ran %d", count.Load())
+	}
+
+	if pool.WorkerCount() != 0 {
+		t.Errorf("Workers should exit on shutdown. Got %d", pool.WorkerCount())
+	}
+
+	if err := pool.ScheduleContext(context.Background(), func() {}); !errors.Is(err, ErrPoolClosed) {
+		t.Errorf("Scheduling after shutdown should return ErrPoolClosed. Got %v", err)
+	}
+}
+
+func TestShutdownFullPool(t *testing.T) {
+	pool := NewPool(1, 1, time.Second)
+	block := fillPool(t, pool)
+
+	scheduled := make(chan bool, 1)
+	scheduledCtx := make(chan error, 1)
+
+	go func() { scheduled <- pool.Schedule(func() {}) }()
+	go func() { scheduledCtx <- pool.ScheduleContext(context.Background(), func() {}) }()
+
+	// Let both callers block on the full queue
+	time.Sleep(10 * time.Millisecond)
+
+	shutdown := make(chan error, 1)
+
+	go func() { shutdown <- pool.Shutdown(context.Background()) }()
+
+	select {
+	case ok := <-scheduled:
+		if ok {
+			t.Errorf("Blocked Schedule should drop its task on shutdown")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Schedule should not block shutdown")
+	}
+
+	select {
+	case err := <-scheduledCtx:
+		if !errors.Is(err, ErrPoolClosed) {
+			t.Errorf("Blocked ScheduleContext should return ErrPoolClosed. Got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("ScheduleContext should not block shutdown")
+	}
+
+	close(block)
+
+	select {
+	case err := <-shutdown:
+		if err != nil {
+			t.Errorf("Shutdown should not fail: %s", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Shutdown should finish once the running task does")
+	}
+}
+
+func TestScheduleGivesUpWhenContextDone(t *testing.T) {
+	pool := NewPool(1, 1, time.Second)
+	block := fillPool(t, pool)
+	defer close(block)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	scheduled := make(chan bool, 1)
+
+	go func() { scheduled <- pool.schedule(ctx, func() {}) }()
+
+	cancel()
+
+	select {
+	case ok := <-scheduled:
+		if ok {
+			t.Errorf("Task should be dropped once the context is done")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Schedule should stop waiting once the context is done")
+	}
+}
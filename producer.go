@@ -11,3 +11,9 @@ type Producer interface {
 type ProducerManager interface {
 	Create(channel *Channel) Producer
 }
+
+// Implemented by producer managers that can report whether their backend is
+// reachable
+type HealthChecker interface {
+	Health(ctx context.Context) error
+}
@@ -0,0 +1,204 @@
+package gosock
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// What happens to a message that exceeds a rate limit
+type RateLimitAction uint8
+
+const (
+	// Silently drop the message
+	RateLimitDrop RateLimitAction = iota
+	// Drop the message and send the client a rate-limited event
+	RateLimitReply
+	// Close the connection with a policy violation
+	RateLimitDisconnect
+)
+
+// Token bucket limit. Rate tokens are added every second up to Burst and
+// each message takes one token.
+type RateLimit struct {
+	Rate   float64
+	Burst  int
+	Action RateLimitAction
+}
+
+// Counts of messages that exceeded a limit by scope
+type RateLimitStats struct {
+	Connection   uint64 `json:"connection"`
+	Event        uint64 `json:"event"`
+	Channel      uint64 `json:"channel"`
+	Disconnected uint64 `json:"disconnected"`
+}
+
+type rateLimitScope string
+
+const (
+	connectionScope rateLimitScope = "connection"
+	eventScope      rateLimitScope = "event"
+	channelScope    rateLimitScope = "channel"
+)
+
+type rateLimitCounters struct {
+	connection   atomic.Uint64
+	event        atomic.Uint64
+	channel      atomic.Uint64
+	disconnected atomic.Uint64
+}
+
+func (rc *rateLimitCounters) stats() RateLimitStats {
+	return RateLimitStats{
+		Connection:   rc.connection.Load(),
+		Event:        rc.event.Load(),
+		Channel:      rc.channel.Load(),
+		Disconnected: rc.disconnected.Load(),
+	}
+}
+
+func (rc *rateLimitCounters) inc(scope rateLimitScope) {
+	switch scope {
+	case connectionScope:
+		rc.connection.Add(1)
+	case eventScope:
+		rc.event.Add(1)
+	case channelScope:
+		rc.channel.Add(1)
+	}
+}
+
+type tokenBucket struct {
+	sync.Mutex
+
+	limit  RateLimit
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(limit RateLimit) *tokenBucket {
+	return &tokenBucket{
+		limit:  limit,
+		tokens: float64(limit.Burst),
+		last:   time.Now(),
+	}
+}
+
+func (b *tokenBucket) allow() bool {
+	b.Lock()
+	defer b.Unlock()
+
+	now := time.Now()
+
+	b.tokens += now.Sub(b.last).Seconds() * b.limit.Rate
+	b.last = now
+
+	if b.tokens > float64(b.limit.Burst) {
+		b.tokens = float64(b.limit.Burst)
+	}
+
+	if b.tokens < 1 {
+		return false
+	}
+
+	b.tokens--
+
+	return true
+}
+
+// Lazily created buckets keyed by what they limit
+type bucketMap struct {
+	sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+func (bm *bucketMap) get(key string, limit RateLimit) *tokenBucket {
+	bm.Lock()
+	defer bm.Unlock()
+
+	if bm.buckets == nil {
+		bm.buckets = make(map[string]*tokenBucket)
+	}
+
+	bucket, ok := bm.buckets[key]
+
+	if !ok {
+		bucket = newTokenBucket(limit)
+		bm.buckets[key] = bucket
+	}
+
+	return bucket
+}
+
+func (bm *bucketMap) deletePrefix(prefix string) {
+	bm.Lock()
+	defer bm.Unlock()
+
+	for key := range bm.buckets {
+		if strings.HasPrefix(key, prefix) {
+			delete(bm.buckets, key)
+		}
+	}
+}
+
+// Key of a connection's bucket for an event on a channel
+func eventBucketKey(path string, event string) string {
+	return path + "\x00" + event
+}
+
+// Limits how many messages each connection can send across all channels.
+// Messages over the limit are rejected before they are scheduled on the pool.
+func (h *Hub) RateLimit(limit RateLimit) {
+	h.Lock()
+	defer h.Unlock()
+
+	h.connLimit = &limit
+}
+
+// Counts of messages that exceeded rate limits since the hub started
+func (h *Hub) RateLimitStats() RateLimitStats {
+	return h.rateLimited.stats()
+}
+
+// Limits how many messages each channel of the router accepts from all of
+// its members combined
+func (r *Router) RateLimit(limit RateLimit) {
+	r.channelLimit = &limit
+}
+
+// Limits how many times each connection can send the event on a channel
+func WithRateLimit(limit RateLimit) EventOption {
+	return func(opts *eventOptions) {
+		opts.rateLimit = &limit
+	}
+}
+
+// Reports whether a message is allowed by bucket and applies the limit's
+// action if not
+func (h *Hub) allowMessage(conn *Conn, msg *Message, scope rateLimitScope, bucket *tokenBucket) bool {
+	if bucket.allow() {
+		return true
+	}
+
+	h.rateLimited.inc(scope)
+
+	switch bucket.limit.Action {
+	case RateLimitReply:
+		conn.sendResponse(&Response{
+			Channel: msg.Channel,
+			Event:   RateLimitedEventName,
+			Payload: J{
+				"event": msg.Event,
+				"scope": scope,
+			},
+		})
+
+	case RateLimitDisconnect:
+		h.rateLimited.disconnected.Add(1)
+		conn.Close(ClosePolicyViolation, "rate limit exceeded")
+	}
+
+	return false
+}
@@ -0,0 +1,166 @@
+package gosock
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gobwas/ws"
+)
+
+func TestTokenBucket(t *testing.T) {
+	bucket := newTokenBucket(RateLimit{Rate: 10, Burst: 3})
+
+	for i := 0; i < 3; i++ {
+		if !bucket.allow() {
+			t.Fatalf("Burst of 3 should be allowed. Rejected message %d", i+1)
+		}
+	}
+
+	if bucket.allow() {
+		t.Errorf("Message over burst should be rejected")
+	}
+
+	// Pretend 100ms has passed which refills one token at 10/s
+	bucket.last = bucket.last.Add(-100 * time.Millisecond)
+
+	if !bucket.allow() {
+		t.Errorf("Bucket should refill over time")
+	}
+
+	if bucket.allow() {
+		t.Errorf("Only one token should have been refilled")
+	}
+}
+
+func TestBucketMapDeletePrefix(t *testing.T) {
+	var bm bucketMap
+	limit := RateLimit{Rate: 1, Burst: 1}
+
+	bm.get(eventBucketKey("chat.1", "chat"), limit)
+	bm.get(eventBucketKey("chat.1", "typing"), limit)
+	bm.get(eventBucketKey("chat.10", "chat"), limit)
+
+	bm.deletePrefix(eventBucketKey("chat.1", ""))
+
+	if len(bm.buckets) != 1 {
+		t.Errorf("Only buckets for chat.1 should be deleted. Got %d left", len(bm.buckets))
+	}
+}
+
+// Collects every frame the hub sends to client
+func readFrames(client net.Conn) chan ws.Frame {
+	frames := make(chan ws.Frame, 16)
+
+	go func() {
+		defer close(frames)
+
+		for {
+			frame, err := ws.ReadFrame(client)
+
+			if err != nil {
+				return
+			}
+
+			frames <- frame
+		}
+	}()
+
+	return frames
+}
+
+func TestEventRateLimitActions(t *testing.T) {
+	tests := []struct {
+		name   string
+		action RateLimitAction
+		check  func(t *testing.T, frame ws.Frame, ok bool)
+	}{
+		{
+			name:   "drop",
+			action: RateLimitDrop,
+			check: func(t *testing.T, frame ws.Frame, ok bool) {
+				if ok {
+					t.Errorf("Dropped message should not be answered. Got %s", frame.Payload)
+				}
+			},
+		},
+		{
+			name:   "reply",
+			action: RateLimitReply,
+			check: func(t *testing.T, frame ws.Frame, ok bool) {
+				response, err := ResponseFromBytes(frame.Payload)
+
+				if !ok || err != nil {
+					t.Fatalf("Expected a reply. Got %v", err)
+				}
+
+				payload, _ := response.Payload.(map[string]interface{})
+
+				if response.Event != RateLimitedEventName || payload["event"] != "chat" || payload["scope"] != string(eventScope) {
+					t.Errorf("Expected %s for chat. Got %s %v", RateLimitedEventName, response.Event, response.Payload)
+				}
+			},
+		},
+		{
+			name:   "disconnect",
+			action: RateLimitDisconnect,
+			check: func(t *testing.T, frame ws.Frame, ok bool) {
+				if !ok || frame.Header.OpCode != ws.OpClose {
+					t.Fatalf("Expected a close frame")
+				}
+
+				if code, _ := ws.ParseCloseFrameData(frame.Payload); code != ws.StatusPolicyViolation {
+					t.Errorf("Expected close %d. Got %d", ws.StatusPolicyViolation, code)
+				}
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			conn, client := makeTestConn(t)
+			hub := conn.hub
+
+			var handled atomic.Int32
+
+			handler := func(ctx context.Context, c *Channel) error {
+				handled.Add(1)
+				return nil
+			}
+
+			hub.Channel("room", func(r *Router) {
+				r.Event("chat", handler, WithRateLimit(RateLimit{Burst: 1, Action: test.action}))
+				r.Event("typing", handler)
+			})
+
+			channel, _ := hub.registry.acquire("room")
+			defer hub.registry.release(channel)
+
+			channel.addConnection(conn)
+			frames := readFrames(client)
+
+			hub.handleMessage(conn, &Message{Channel: "room", Event: "chat"})
+			hub.handleMessage(conn, &Message{Channel: "room", Event: "chat"})
+
+			// Other events on the channel have their own limits
+			hub.handleMessage(conn, &Message{Channel: "room", Event: "typing"})
+
+			if handled.Load() != 2 {
+				t.Errorf("Expected 2 handled messages. Got %d", handled.Load())
+			}
+
+			if stats := hub.RateLimitStats(); stats.Event != 1 {
+				t.Errorf("Expected 1 event limited message. Got %d", stats.Event)
+			}
+
+			select {
+			case frame, ok := <-frames:
+				test.check(t, frame, ok)
+			case <-time.After(50 * time.Millisecond):
+				test.check(t, ws.Frame{}, false)
+			}
+		})
+	}
+}
@@ -0,0 +1,198 @@
+package gosock
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+var ErrChannelClosed = errors.New("Channel is closed")
+
+// Tracks the open channels of a hub. Finding, creating and removing channels
+// all happen under one lock so a channel is never handed out once it has
+// started closing.
+//
+// Each channel counts references held by its local members and by messages
+// being handled for it. A channel is only closed when it has no references
+// and no members on other nodes. Anything holding a channel without a
+// reference, such as the result of Hub.Lookup, may find it closed, in which
+// case sends are dropped and joins fail with ErrChannelClosed.
+type channelRegistry struct {
+	sync.Mutex
+
+	hub      *Hub
+	channels map[string]*Channel
+}
+
+func newChannelRegistry(hub *Hub) *channelRegistry {
+	return &channelRegistry{
+		hub:      hub,
+		channels: make(map[string]*Channel),
+	}
+}
+
+// Returns the open channel for path without creating it
+func (cr *channelRegistry) find(path string) (*Channel, bool) {
+	cr.Lock()
+	channel, ok := cr.channels[path]
+	cr.Unlock()
+
+	if !ok {
+		return nil, false
+	}
+
+	<-channel.ready
+
+	if channel.createErr != nil {
+		return nil, false
+	}
+
+	return channel, true
+}
+
+// Returns the channel for path, creating it if a router matches. The
+// returned reference must be released. Fails with the OnCreate hook's error
+// if the channel could not be created.
+func (cr *channelRegistry) acquire(path string) (*Channel, error) {
+	cr.Lock()
+	channel, ok := cr.channels[path]
+
+	if ok {
+		channel.refs++
+		cr.Unlock()
+
+		// Wait for the OnCreate hook if another caller is still creating it
+		<-channel.ready
+
+		if channel.createErr != nil {
+			return nil, channel.createErr
+		}
+
+		return channel, nil
+	}
+
+	node, params := cr.hub.channels.Lookup(path)
+
+	if node == nil || node.Channel == nil {
+		cr.Unlock()
+		return nil, fmt.Errorf("%w: %s", ErrChannelNotFound, path)
+	}
+
+	channel = newChannel(path, params, node.Channel)
+	cr.channels[path] = channel
+	channel.refs++
+	cr.Unlock()
+
+	go channel.writer()
+
+	if err := channel.create(); err != nil {
+		cr.discard(channel)
+		return nil, err
+	}
+
+	return channel, nil
+}
+
+// Removes a channel whose OnCreate hook failed so the next caller tries to
+// create it again
+func (cr *channelRegistry) discard(channel *Channel) {
+	cr.Lock()
+	defer cr.Unlock()
+
+	if cr.channels[channel.path] == channel {
+		delete(cr.channels, channel.path)
+	}
+
+	channel.removed = true
+}
+
+// Returns the open channel for path with a reference that must be released.
+// Never creates a channel.
+func (cr *channelRegistry) acquireOpen(path string) (*Channel, bool) {
+	channel, ok := cr.find(path)
+
+	if !ok || cr.retain(channel) != nil {
+		return nil, false
+	}
+
+	return channel, true
+}
+
+// Adds a reference to a channel. Fails if the channel has been removed.
+func (cr *channelRegistry) retain(channel *Channel) error {
+	cr.Lock()
+	defer cr.Unlock()
+
+	if channel.removed {
+		return ErrChannelClosed
+	}
+
+	channel.refs++
+
+	return nil
+}
+
+// Drops a reference and closes the channel once nothing references it
+func (cr *channelRegistry) release(channel *Channel) {
+	cr.Lock()
+	channel.refs--
+	unused := channel.refs == 0
+	cr.Unlock()
+
+	if unused {
+		channel.closeIfEmpty()
+	}
+}
+
+// Removes a channel that has no references. Returns false if it gained a
+// reference, was already removed or was never registered, in which case it
+// must not be closed.
+func (cr *channelRegistry) remove(channel *Channel) bool {
+	cr.Lock()
+	defer cr.Unlock()
+
+	if channel.refs > 0 || channel.removed || cr.channels[channel.path] != channel {
+		return false
+	}
+
+	delete(cr.channels, channel.path)
+	channel.removed = true
+
+	return true
+}
+
+// Open channels, sorted by path. Only channels of router if it is not nil.
+func (cr *channelRegistry) list(router *Router) []*Channel {
+	cr.Lock()
+	channels := make([]*Channel, 0, len(cr.channels))
+
+	for _, channel := range cr.channels {
+		if router == nil || channel.router == router {
+			channels = append(channels, channel)
+		}
+	}
+	cr.Unlock()
+
+	sort.Slice(channels, func(i, j int) bool {
+		return channels[i].path < channels[j].path
+	})
+
+	return channels
+}
+
+// Open channels nothing on this node references
+func (cr *channelRegistry) unused() []*Channel {
+	cr.Lock()
+	defer cr.Unlock()
+
+	var channels []*Channel
+
+	for _, channel := range cr.channels {
+		if channel.refs == 0 {
+			channels = append(channels, channel)
+		}
+	}
+
+	return channels
+}
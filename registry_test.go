@@ -0,0 +1,214 @@
+package gosock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Connection whose client side discards everything it is sent
+func makeDrainedConn(t *testing.T, hub *Hub, id string) *Conn {
+	t.Helper()
+
+	server, client := net.Pipe()
+	t.Cleanup(func() { client.Close() })
+
+	go io.Copy(io.Discard, client)
+
+	return newConn(context.Background(), id, server, hub)
+}
+
+func waitForChannels(t *testing.T, hub *Hub, want int) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+
+	for len(hub.registry.list(nil)) != want && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	if got := len(hub.registry.list(nil)); got != want {
+		t.Fatalf("Expected %d open channels. Got %d", want, got)
+	}
+}
+
+func TestRegistryRefCounting(t *testing.T) {
+	hub := makeHub()
+	hub.Channel("room.{id}", func(r *Router) {})
+
+	first, _ := hub.registry.acquire("room.1")
+	second, _ := hub.registry.acquire("room.1")
+
+	if first != second {
+		t.Fatalf("Acquiring an open path should return the same channel")
+	}
+
+	hub.registry.release(first)
+	waitForChannels(t, hub, 1)
+
+	hub.registry.release(second)
+	waitForChannels(t, hub, 0)
+
+	if err := hub.registry.retain(first); err != ErrChannelClosed {
+		t.Errorf("Retaining a removed channel should fail. Got %v", err)
+	}
+
+	// Sending to a closed channel is dropped instead of panicking
+	first.SendResp(&Response{Event: "late"})
+
+	if _, err := hub.registry.acquire("missing"); !errors.Is(err, ErrChannelNotFound) {
+		t.Errorf("Paths without a router should not open a channel")
+	}
+}
+
+func TestRegistryMemberKeepsChannelOpen(t *testing.T) {
+	hub := makeHub()
+	hub.Channel("room.{id}", func(r *Router) {})
+	conn := makeDrainedConn(t, hub, "member")
+
+	channel, _ := hub.registry.acquire("room.1")
+
+	if err := channel.addConnection(conn); err != nil {
+		t.Fatalf("Join failed: %s", err)
+	}
+
+	// Joining twice only holds one reference
+	channel.addConnection(conn)
+	hub.registry.release(channel)
+
+	time.Sleep(10 * time.Millisecond)
+	waitForChannels(t, hub, 1)
+
+	channel.removeConnection(conn)
+	waitForChannels(t, hub, 0)
+}
+
+// Members join and leave the same channels while messages are emitted to
+// them. Run with -race.
+func TestRegistryConcurrentJoinLeave(t *testing.T) {
+	hub := makeHub()
+	hub.Channel("room.{id}", func(r *Router) {})
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 20; i++ {
+		conn := makeDrainedConn(t, hub, fmt.Sprintf("conn-%d", i))
+		path := fmt.Sprintf("room.%d", i%3)
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 50; j++ {
+				channel, err := hub.registry.acquire(path)
+
+				if err != nil {
+					t.Errorf("Channel %s should exist: %s", path, err)
+					return
+				}
+
+				// Holding a reference means the channel can not have closed
+				if err := channel.addConnection(conn); err != nil {
+					t.Errorf("Join with a reference should not fail. Got %s", err)
+				}
+
+				hub.registry.release(channel)
+
+				channel.SendResp(&Response{Channel: path, Event: "tick"})
+				channel.removeConnection(conn)
+			}
+		}()
+	}
+
+	wg.Wait()
+	waitForChannels(t, hub, 0)
+}
+
+func TestOnlyJoinOpensChannel(t *testing.T) {
+	conn, _ := makeTestConn(t)
+	hub := conn.hub
+
+	var creates atomic.Int32
+
+	hub.Channel("room.{id}", func(r *Router) {
+		r.On(r.Join(func(ctx context.Context, c *Channel) error { return nil }))
+		r.Event("chat", func(ctx context.Context, c *Channel) error { return nil })
+		r.OnCreate(func(ctx context.Context, c *Channel) error {
+			creates.Add(1)
+			return nil
+		})
+	})
+
+	for _, event := range []string{"chat", "unknown", LeaveEventName} {
+		hub.handleMessage(conn, &Message{Channel: "room.999", Event: event})
+	}
+
+	if creates.Load() != 0 {
+		t.Errorf("Events other than join should not open channels. Opened %d", creates.Load())
+	}
+
+	waitForChannels(t, hub, 0)
+}
+
+// Producer whose Subscribe blocks until released, standing in for one that
+// subscribes over the network
+type slowProducer struct {
+	*BaseProducer
+	subscribing chan struct{}
+	release     chan struct{}
+}
+
+func (sp *slowProducer) Subscribe() {
+	close(sp.subscribing)
+	<-sp.release
+	sp.BaseProducer.Subscribe()
+}
+
+type slowProducerManager struct {
+	slow *slowProducer
+}
+
+func (spm *slowProducerManager) Create(channel *Channel) Producer {
+	if channel.Path() == "room.slow" {
+		spm.slow.BaseProducer = NewBaseProducer(channel)
+		return spm.slow
+	}
+
+	return NewBaseProducer(channel)
+}
+
+func TestSubscribeOutsideRegistryLock(t *testing.T) {
+	hub := makeHub()
+	hub.Channel("room.{id}", func(r *Router) {})
+
+	slow := &slowProducer{subscribing: make(chan struct{}), release: make(chan struct{})}
+	hub.AddProducerManager(&slowProducerManager{slow: slow})
+
+	go hub.registry.acquire("room.slow")
+	<-slow.subscribing
+
+	acquired := make(chan error, 1)
+
+	go func() {
+		_, err := hub.registry.acquire("room.fast")
+		acquired <- err
+	}()
+
+	select {
+	case err := <-acquired:
+		if err != nil {
+			t.Errorf("Channel room.fast should open: %s", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("A slow subscribe should not block other channels from opening")
+	}
+
+	close(slow.release)
+}
@@ -2,28 +2,58 @@ package gosock
 
 import (
 	"context"
+	"fmt"
+	"sort"
 	"sync"
+	"time"
 )
 
 type EventHandler func(context.Context, *Channel) error
 
 type RouterOnInit func(*Router)
 
+// Wraps every event and lifecycle handler of a router
+type EventMiddleware func(EventHandler) EventHandler
+
+// Configures a single event registered with Router.Event
+type EventOption func(*eventOptions)
+
+type eventOptions struct {
+	rateLimit *RateLimit
+	timeout   time.Duration
+}
+
+// Cancels the handler's context after timeout. The client is sent an error
+// event if the handler is still running when it expires.
+func WithTimeout(timeout time.Duration) EventOption {
+	return func(opts *eventOptions) {
+		opts.timeout = timeout
+	}
+}
+
 type Router struct {
 	sync.RWMutex
 	hub      *Hub
 	path     string
-	channels map[string]*Channel
 	handlers map[string]EventHandler
+	options  map[string]*eventOptions
 
 	routerHandlers map[string]EventHandler
+
+	middlewares []EventMiddleware
+
+	channelLimit *RateLimit
+
+	onCreate   EventHandler
+	onClose    EventHandler
+	closeGrace time.Duration
 }
 
 func NewRouter(path string, hub *Hub) *Router {
 	return &Router{
 		path:           path,
-		channels:       make(map[string]*Channel),
 		handlers:       make(map[string]EventHandler),
+		options:        make(map[string]*eventOptions),
 		routerHandlers: make(map[string]EventHandler),
 		hub:            hub,
 	}
@@ -39,7 +69,7 @@ func (r *Router) On(handlerInit ...RouterOnInit) *Router {
 
 func (r *Router) Join(handler EventHandler) RouterOnInit {
 	return func(router *Router) {
-		router.routerHandlers[joinEventName] = handler
+		router.routerHandlers[JoinEventName] = handler
 	}
 }
 
@@ -57,7 +87,7 @@ func (r *Router) AfterLeave(handler EventHandler) RouterOnInit {
 
 func (r *Router) Leave(handler EventHandler) RouterOnInit {
 	return func(router *Router) {
-		router.routerHandlers[leaveEventName] = handler
+		router.routerHandlers[LeaveEventName] = handler
 	}
 }
 
@@ -67,26 +97,129 @@ func (r *Router) Disconnect(handler EventHandler) RouterOnInit {
 	}
 }
 
-func (r *Router) Event(event string, handler EventHandler) {
+// Runs when a channel of this router is created, before its first member
+// joins. Joins wait for the hook to finish so it can load state into
+// Channel.State. The channel's params are available from the context.
+func (r *Router) OnCreate(hook EventHandler) {
+	r.onCreate = hook
+}
+
+// Runs after a channel of this router has closed, such as to persist its
+// state
+func (r *Router) OnClose(hook EventHandler) {
+	r.onClose = hook
+}
+
+// Keeps empty channels open for grace before closing them. A member joining
+// during the grace period keeps the channel and its state.
+func (r *Router) CloseGrace(grace time.Duration) {
+	r.closeGrace = grace
+}
+
+func (r *Router) Event(event string, handler EventHandler, options ...EventOption) {
+	opts := &eventOptions{}
+
+	for _, option := range options {
+		option(opts)
+	}
+
 	r.handlers[event] = handler
+	r.options[event] = opts
 }
 
-func (r *Router) addChannel(path string, params *Params) *Channel {
-	r.Lock()
-	defer r.Unlock()
+func (r *Router) eventOptions(event string) *eventOptions {
+	if opts, ok := r.options[event]; ok {
+		return opts
+	}
 
-	channel := newChannel(path, params, r)
-	r.channels[path] = channel
+	return &eventOptions{}
+}
 
-	go channel.writer()
+// Adds middleware that runs around every event and lifecycle handler
+func (r *Router) Use(middlewares ...EventMiddleware) {
+	r.middlewares = append(r.middlewares, middlewares...)
+}
+
+// Returns the handler for an event wrapped in the router's middleware
+func (r *Router) eventHandler(event string) (EventHandler, bool) {
+	handler, ok := r.handlers[event]
+
+	if !ok {
+		return nil, false
+	}
 
-	return channel
+	return r.wrap(handler), true
 }
 
-func (r *Router) removeChannel(path string) {
-	r.Lock()
-	defer r.Unlock()
+// Returns the handler for a lifecycle event wrapped in the router's middleware
+func (r *Router) lifecycleHandler(event string) (EventHandler, bool) {
+	handler, ok := r.routerHandlers[event]
+
+	if !ok {
+		return nil, false
+	}
+
+	return r.wrap(handler), true
+}
+
+func (r *Router) wrap(handler EventHandler) EventHandler {
+	for i := len(r.middlewares) - 1; i >= 0; i-- {
+		handler = r.middlewares[i](handler)
+	}
+
+	return handler
+}
+
+// Pattern the router was registered with
+func (r *Router) Pattern() string {
+	return r.path
+}
+
+// Builds a concrete channel name from the router's pattern using values for
+// each param in the order they appear in the pattern.
+//
+//	// Router registered with "org.{orgId}.chat.{roomId}"
+//	router.Path("42", "general") // org.42.chat.general
+func (r *Router) Path(values ...string) (string, error) {
+	names := paramNames(r.path)
+
+	if len(values) > len(names) {
+		return "", fmt.Errorf("%w: %d values given for %d params in %q", ErrInvalidParam, len(values), len(names), r.path)
+	}
+
+	params := make(map[string]string, len(values))
+
+	for i, val := range values {
+		params[names[i]] = val
+	}
+
+	return BuildPath(r.path, params)
+}
+
+// Names of the events the router handles, sorted
+func (r *Router) Events() []string {
+	return sortedKeys(r.handlers)
+}
+
+// Names of the lifecycle events (__join__, __leave__, etc) the router
+// handles, sorted
+func (r *Router) LifecycleEvents() []string {
+	return sortedKeys(r.routerHandlers)
+}
+
+func sortedKeys(handlers map[string]EventHandler) []string {
+	keys := make([]string, 0, len(handlers))
+
+	for key := range handlers {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
 
-	delete(r.channels, path)
-	r.hub.removeCachedChannel(path)
+// Channels of this router that are open on this node
+func (r *Router) Channels() []*Channel {
+	return r.hub.registry.list(r)
 }
@@ -0,0 +1,101 @@
+package gosock
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Server mounts several hubs as namespaces on one HTTP handler. Each
+// namespace has its own routes, middleware and connections while sharing the
+// server's pool, producer manager and membership registry.
+//
+//	server := gosock.NewServer(pool)
+//	admin := server.Namespace("admin")   // served at /admin
+//	public := server.Namespace("public") // served at /public
+type Server struct {
+	sync.RWMutex
+
+	pool   *Pool
+	nodeId string
+
+	producerManager ProducerManager
+	membership      Membership
+
+	hubs map[string]*Hub
+	mux  *http.ServeMux
+}
+
+func NewServer(pool *Pool) *Server {
+	return &Server{
+		pool:            pool,
+		nodeId:          newNodeId(),
+		producerManager: &BaseProducerManager{},
+		membership:      NewMemoryMembership(),
+		hubs:            make(map[string]*Hub),
+		mux:             http.NewServeMux(),
+	}
+}
+
+// Returns the hub for a namespace, creating it if needed. The hub is served
+// at /name. An empty name is served at /.
+func (s *Server) Namespace(name string) *Hub {
+	name = strings.Trim(name, "/")
+
+	s.Lock()
+	defer s.Unlock()
+
+	if hub, ok := s.hubs[name]; ok {
+		return hub
+	}
+
+	hub := NewHub(s.pool)
+	hub.namespace = name
+	hub.nodeId = s.nodeId
+	hub.producerManager = s.producerManager
+	hub.membership = s.membership
+
+	s.hubs[name] = hub
+	s.mux.Handle("/"+name, hub)
+
+	return hub
+}
+
+// Sets the producer manager shared by every namespace
+func (s *Server) AddProducerManager(manager ProducerManager) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.producerManager = manager
+
+	for _, hub := range s.hubs {
+		hub.AddProducerManager(manager)
+	}
+}
+
+// Sets the membership registry shared by every namespace
+func (s *Server) AddMembership(membership Membership) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.membership = membership
+
+	for _, hub := range s.hubs {
+		hub.AddMembership(membership)
+	}
+}
+
+// Starts every namespace. Must be called after all namespaces and their
+// routes have been registered.
+func (s *Server) Start() {
+	s.RLock()
+	defer s.RUnlock()
+
+	for _, hub := range s.hubs {
+		hub.Start()
+	}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
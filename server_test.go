@@ -0,0 +1,78 @@
+package gosock
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestServerNamespaces(t *testing.T) {
+	server := NewServer(NewPool(1, 1, time.Second))
+
+	admin := server.Namespace("admin")
+	public := server.Namespace("/public/")
+
+	if server.Namespace("admin") != admin {
+		t.Errorf("Namespace should return the existing hub")
+	}
+
+	if public.Namespace() != "public" {
+		t.Errorf("Namespace name should be trimmed. Got %s", public.Namespace())
+	}
+
+	if admin.NodeId() != public.NodeId() || admin.membership != public.membership {
+		t.Errorf("Namespaces should share node id and membership")
+	}
+
+	admin.Channel("chat.{id}", func(r *Router) {})
+	public.Channel("chat.{id}", func(r *Router) {})
+
+	if len(admin.Routes()) != 1 || len(public.Routes()) != 1 {
+		t.Errorf("Namespaces should have separate routes")
+	}
+
+	adminNode, _ := admin.channels.Lookup("chat.1")
+	publicNode, _ := public.channels.Lookup("chat.1")
+
+	adminChannel := newChannel("chat.1", nil, adminNode.Channel)
+	publicChannel := newChannel("chat.1", nil, publicNode.Channel)
+
+	if adminChannel.Key() == publicChannel.Key() {
+		t.Errorf("Channel keys should be namespaced. Got %s", adminChannel.Key())
+	}
+}
+
+func TestServerNamespacedMembership(t *testing.T) {
+	server := NewServer(NewPool(1, 1, time.Second))
+
+	admin := server.Namespace("admin")
+	public := server.Namespace("public")
+
+	admin.Channel("chat.{id}", func(r *Router) {})
+	public.Channel("chat.{id}", func(r *Router) {})
+
+	adminNode, _ := admin.channels.Lookup("chat.1")
+	publicNode, _ := public.channels.Lookup("chat.1")
+
+	adminChannel := newChannel("chat.1", nil, adminNode.Channel)
+	publicChannel := newChannel("chat.1", nil, publicNode.Channel)
+
+	conn := newConn(context.Background(), "member", nil, admin)
+	adminChannel.addConnection(conn)
+
+	if count := adminChannel.MemberCount(); count != 1 {
+		t.Errorf("Member should be counted under the namespaced key. Got %d", count)
+	}
+
+	if count := publicChannel.MemberCount(); count != 0 {
+		t.Errorf("Same path in another namespace should have no members. Got %d", count)
+	}
+
+	adminChannel.removeConnection(conn)
+
+	count, _ := admin.membership.Count(context.Background(), adminChannel.Key())
+
+	if count != 0 {
+		t.Errorf("Removing the member should clear the namespaced key. Got %d", count)
+	}
+}
@@ -0,0 +1,215 @@
+package gosock
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+const defaultSessionBufferSize = 256
+
+var ErrSessionNotFound = errors.New("Session not found or expired")
+
+type resumePayload struct {
+	Token string `json:"token"`
+}
+
+type session struct {
+	conn  *Conn
+	timer *time.Timer
+}
+
+// Keeps disconnected connections around for a grace period so a client can
+// reconnect and pick up where it left off. While detached a connection keeps
+// its channel memberships and buffers anything sent to it.
+type sessionManager struct {
+	sync.Mutex
+
+	grace      time.Duration
+	bufferSize int
+
+	detached map[string]*session
+}
+
+func newSessionManager(grace time.Duration, bufferSize int) *sessionManager {
+	if bufferSize <= 0 {
+		bufferSize = defaultSessionBufferSize
+	}
+
+	return &sessionManager{
+		grace:      grace,
+		bufferSize: bufferSize,
+		detached:   make(map[string]*session),
+	}
+}
+
+func newSessionToken() string {
+	return randomHex(16)
+}
+
+// Detaches a connection whose socket has closed. Returns false if the
+// connection has no session and should be disconnected right away.
+func (sm *sessionManager) detach(conn *Conn) bool {
+	conn.Lock()
+	token := conn.session
+	conn.detached = token != ""
+	conn.Unlock()
+
+	if token == "" {
+		return false
+	}
+
+	sm.Lock()
+	defer sm.Unlock()
+
+	sm.detached[token] = &session{
+		conn: conn,
+		timer: time.AfterFunc(sm.grace, func() {
+			if sm.take(token, nil) != nil {
+				log.Printf("Session for connection %s expired", conn.Id)
+				conn.disconnect()
+			}
+		}),
+	}
+
+	return true
+}
+
+// Removes and returns the detached connection for token. Only one caller
+// will ever receive a given connection. If match is given the session is
+// left in place unless match accepts its connection.
+func (sm *sessionManager) take(token string, match func(*Conn) bool) *Conn {
+	sm.Lock()
+	defer sm.Unlock()
+
+	s, ok := sm.detached[token]
+
+	if !ok || (match != nil && !match(s.conn)) {
+		return nil
+	}
+
+	s.timer.Stop()
+	delete(sm.detached, token)
+
+	return s.conn
+}
+
+// Reattaches a detached connection's channels to conn and flushes everything
+// that was buffered while it was gone.
+func (h *Hub) resume(conn *Conn, token string) error {
+	if h.sessions == nil || token == "" {
+		return ErrSessionNotFound
+	}
+
+	var match func(*Conn) bool
+
+	// A session can only be resumed by the user it belongs to
+	if h.auth != nil {
+		userId := conn.UserId()
+		match = func(old *Conn) bool {
+			return old.UserId() == userId
+		}
+	}
+
+	old := h.sessions.take(token, match)
+
+	if old == nil {
+		return ErrSessionNotFound
+	}
+
+	old.Lock()
+	channels := old.channels
+	buffer := old.buffer
+	old.channels = make(map[*Channel]bool)
+	old.buffer = nil
+	old.Unlock()
+
+	// Values stored on the old connection carry over as well
+	for key, val := range old.state.All() {
+		conn.Set(key, val)
+	}
+
+	paths := make([]string, 0, len(channels))
+
+	// Holding the new connection's lock keeps channel writers from sending
+	// to it until the buffered messages have been flushed in order.
+	conn.Lock()
+	for channel := range channels {
+		channel.replaceConnection(old, conn)
+		conn.channels[channel] = true
+		paths = append(paths, channel.Path())
+	}
+
+	resumed, _ := (&Response{
+		Event:   ResumedEventName,
+		Payload: J{"channels": paths},
+	}).Encode()
+
+	conn.writeLocked(resumed)
+
+	for _, msg := range buffer {
+		conn.writeLocked(msg)
+	}
+	conn.Unlock()
+
+	old.cancelContext()
+	h.disconnect <- old
+
+	return nil
+}
+
+func (h *Hub) handleResume(conn *Conn, msg *Message) {
+	var payload resumePayload
+
+	if err := msg.BindPayload(&payload); err != nil {
+		conn.sendResponse(&Response{
+			Event:   ErrorEventName,
+			Payload: J{"error": err.Error()},
+		})
+		return
+	}
+
+	if err := h.resume(conn, payload.Token); err != nil {
+		conn.sendResponse(&Response{
+			Event:   ResumeFailedEventName,
+			Payload: J{"error": err.Error()},
+		})
+	}
+}
+
+func (c *Channel) replaceConnection(old *Conn, conn *Conn) {
+	c.Lock()
+	// If conn already joined the channel on its own the old connection's
+	// reference is no longer needed
+	duplicate := c.conns[conn]
+
+	delete(c.conns, old)
+	c.conns[conn] = true
+
+	// Membership state carries over to the resumed connection unless it
+	// already has its own
+	if state, ok := c.states[old]; ok {
+		if !duplicate {
+			c.states[conn] = state
+		}
+		delete(c.states, old)
+	}
+	c.Unlock()
+
+	if duplicate {
+		c.hub.registry.release(c)
+	}
+
+	ctx := context.Background()
+	membership := c.hub.getMembership()
+
+	if err := membership.Remove(ctx, c.hub.nodeId, c.Key(), old.Id); err != nil {
+		log.Printf("Error removing member %s from channel %s: %s", old.Id, c.path, err)
+	}
+
+	if err := membership.Add(ctx, c.hub.nodeId, c.Key(), conn.Id); err != nil {
+		log.Printf("Error adding member %s to channel %s: %s", conn.Id, c.path, err)
+	}
+}
@@ -0,0 +1,225 @@
+package gosock
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func makeSessionHub(grace time.Duration, bufferSize int) *Hub {
+	hub := makeHub()
+	hub.EnableSessions(grace, bufferSize)
+	hub.Channel("room.{id}", func(r *Router) {})
+	hub.Start()
+
+	return hub
+}
+
+// Joins a connection with a session to room.1 and drops its socket
+func makeDetachedConn(t *testing.T, hub *Hub) (*Conn, *Channel) {
+	t.Helper()
+
+	conn := makeDrainedConn(t, hub, "old")
+	conn.session = newSessionToken()
+
+	channel, _ := hub.registry.acquire("room.1")
+	defer hub.registry.release(channel)
+
+	if err := channel.addConnection(conn); err != nil {
+		t.Fatalf("Join failed: %s", err)
+	}
+
+	conn.close()
+
+	return conn, channel
+}
+
+func makePipeConn(t *testing.T, hub *Hub, id string) (*Conn, net.Conn) {
+	t.Helper()
+
+	server, client := net.Pipe()
+	t.Cleanup(func() { client.Close() })
+
+	return newConn(context.Background(), id, server, hub), client
+}
+
+func waitForBuffer(t *testing.T, conn *Conn, want int) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+
+	for time.Now().Before(deadline) {
+		conn.RLock()
+		got := len(conn.buffer)
+		conn.RUnlock()
+
+		if got == want {
+			return
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	t.Fatalf("Expected %d buffered messages", want)
+}
+
+func TestSessionDetach(t *testing.T) {
+	hub := makeSessionHub(time.Minute, 0)
+	conn, channel := makeDetachedConn(t, hub)
+
+	conn.RLock()
+	detached := conn.detached
+	conn.RUnlock()
+
+	if !detached {
+		t.Fatalf("Connection with a session should detach when its socket closes")
+	}
+
+	if !channel.hasConn(conn) {
+		t.Errorf("Detached connection should stay a member of its channels")
+	}
+
+	waitForChannels(t, hub, 1)
+}
+
+func TestSessionResumeReplaysBuffer(t *testing.T) {
+	hub := makeSessionHub(time.Minute, 0)
+	old, channel := makeDetachedConn(t, hub)
+
+	channel.SendResp(&Response{Channel: "room.1", Event: "first"})
+	channel.SendResp(&Response{Channel: "room.1", Event: "second"})
+	waitForBuffer(t, old, 2)
+
+	conn, client := makePipeConn(t, hub, "new")
+	errs := make(chan error, 1)
+
+	go func() { errs <- hub.resume(conn, old.session) }()
+
+	for _, event := range []string{ResumedEventName, "first", "second"} {
+		if response := readTestResponse(t, client); response.Event != event {
+			t.Errorf("Expected %s. Got %s", event, response.Event)
+		}
+	}
+
+	if err := <-errs; err != nil {
+		t.Fatalf("Resume failed: %s", err)
+	}
+
+	if !channel.hasConn(conn) || channel.hasConn(old) {
+		t.Errorf("Resumed connection should replace the old one in its channels")
+	}
+}
+
+func TestSessionBufferOverflow(t *testing.T) {
+	hub := makeSessionHub(time.Minute, 2)
+	old, channel := makeDetachedConn(t, hub)
+
+	for _, event := range []string{"first", "second", "third"} {
+		channel.SendResp(&Response{Channel: "room.1", Event: event})
+	}
+
+	// The oldest message is dropped once the buffer is full
+	deadline := time.Now().Add(2 * time.Second)
+
+	for time.Now().Before(deadline) {
+		old.RLock()
+		buffer := old.buffer
+		old.RUnlock()
+
+		if len(buffer) == 2 {
+			if bytes.Contains(buffer[0], []byte("second")) {
+				return
+			}
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+
+	t.Errorf("Buffer should hold the 2 newest messages")
+}
+
+func TestSessionExpires(t *testing.T) {
+	hub := makeSessionHub(20*time.Millisecond, 0)
+	old, _ := makeDetachedConn(t, hub)
+
+	// The channel closes once the detached member is gone
+	waitForChannels(t, hub, 0)
+
+	conn, _ := makePipeConn(t, hub, "new")
+
+	if err := hub.resume(conn, old.session); err != ErrSessionNotFound {
+		t.Errorf("Expired session should not resume. Got %v", err)
+	}
+}
+
+func TestSessionUnknownToken(t *testing.T) {
+	hub := makeSessionHub(time.Minute, 0)
+	old, _ := makeDetachedConn(t, hub)
+
+	conn := makeDrainedConn(t, hub, "new")
+
+	if err := hub.resume(conn, "unknown"); err != ErrSessionNotFound {
+		t.Errorf("Unknown token should not resume. Got %v", err)
+	}
+
+	if err := hub.resume(conn, old.session); err != nil {
+		t.Fatalf("Resume failed: %s", err)
+	}
+
+	other := makeDrainedConn(t, hub, "other")
+
+	if err := hub.resume(other, old.session); err != ErrSessionNotFound {
+		t.Errorf("Token should only resume once. Got %v", err)
+	}
+}
+
+func TestSessionResumeRequiresSameUser(t *testing.T) {
+	hub := makeSessionHub(time.Minute, 0)
+	hub.Authenticate(testAuthenticator)
+
+	expires := time.Now().Add(time.Hour)
+
+	old := makeDrainedConn(t, hub, "old")
+	old.session = newSessionToken()
+	old.authenticate(&Identity{UserId: "alice", ExpiresAt: expires})
+	old.close()
+
+	mallory := makeDrainedConn(t, hub, "mallory")
+	mallory.authenticate(&Identity{UserId: "mallory", ExpiresAt: expires})
+
+	if err := hub.resume(mallory, old.session); err != ErrSessionNotFound {
+		t.Errorf("Another user should not resume the session. Got %v", err)
+	}
+
+	alice := makeDrainedConn(t, hub, "alice")
+	alice.authenticate(&Identity{UserId: "alice", ExpiresAt: expires})
+
+	if err := hub.resume(alice, old.session); err != nil {
+		t.Errorf("Session should still resume for its own user. Got %s", err)
+	}
+}
+
+func TestSessionResumeExistingMember(t *testing.T) {
+	hub := makeSessionHub(time.Minute, 0)
+	old, channel := makeDetachedConn(t, hub)
+
+	conn := makeDrainedConn(t, hub, "new")
+
+	// The new connection joins the channel before resuming
+	if _, err := hub.Join(conn, "room.1"); err != nil {
+		t.Fatalf("Join failed: %s", err)
+	}
+
+	if err := hub.resume(conn, old.session); err != nil {
+		t.Fatalf("Resume failed: %s", err)
+	}
+
+	if count := channel.MemberCount(); count != 1 {
+		t.Errorf("Expected 1 member. Got %d", count)
+	}
+
+	channel.removeConnection(conn)
+	waitForChannels(t, hub, 0)
+}
@@ -0,0 +1,52 @@
+package gosock
+
+import "sync"
+
+// Concurrency safe key/value store
+type State struct {
+	sync.RWMutex
+	values map[string]interface{}
+}
+
+func NewState() *State {
+	return &State{
+		values: make(map[string]interface{}),
+	}
+}
+
+func (s *State) Get(key string) (interface{}, bool) {
+	s.RLock()
+	defer s.RUnlock()
+
+	val, ok := s.values[key]
+
+	return val, ok
+}
+
+func (s *State) Set(key string, val interface{}) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.values[key] = val
+}
+
+func (s *State) Delete(key string) {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.values, key)
+}
+
+// Copy of every key/value pair
+func (s *State) All() map[string]interface{} {
+	s.RLock()
+	defer s.RUnlock()
+
+	values := make(map[string]interface{}, len(s.values))
+
+	for key, val := range s.values {
+		values[key] = val
+	}
+
+	return values
+}
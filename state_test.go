@@ -0,0 +1,49 @@
+package gosock
+
+import (
+	"context"
+	"testing"
+)
+
+func TestConnState(t *testing.T) {
+	conn := newConn(context.Background(), "test", nil, makeHub())
+
+	conn.Set("score", 10)
+
+	if val, ok := conn.Get("score"); !ok || val != 10 {
+		t.Errorf("Get should return stored value. Got %v %v", val, ok)
+	}
+
+	conn.Delete("score")
+
+	if _, ok := conn.Get("score"); ok {
+		t.Errorf("Deleted value should not exist")
+	}
+}
+
+func TestChannelConnState(t *testing.T) {
+	hub := makeHub()
+	router := NewRouter("game.{id}", hub)
+	channel := newChannel("game.1", nil, router)
+	conn := newConn(context.Background(), "test", nil, hub)
+
+	if channel.ConnState(conn) != nil {
+		t.Errorf("Non members should not have state")
+	}
+
+	channel.addConnection(conn)
+	channel.ConnState(conn).Set("ready", true)
+
+	// Joining again keeps the existing state
+	channel.addConnection(conn)
+
+	if ready, _ := channel.ConnState(conn).Get("ready"); ready != true {
+		t.Errorf("State should persist while joined")
+	}
+
+	channel.removeConnection(conn)
+
+	if channel.ConnState(conn) != nil {
+		t.Errorf("State should be discarded on leave")
+	}
+}
@@ -2,7 +2,18 @@ package gosock
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var (
+	ErrDuplicateRoute   = errors.New("route is already registered")
+	ErrConflictingRoute = errors.New("route conflicts with a registered route")
+	ErrInvalidRoute     = errors.New("invalid route pattern")
 )
 
 type NodeType uint8
@@ -10,13 +21,27 @@ type NodeType uint8
 const (
 	StaticNode NodeType = iota
 	ParamNode
+	CatchAllNode
 )
 
+// Named constraints that can be used in params like `{id:int}`. Any other
+// constraint is treated as a regular expression that must match the whole
+// segment.
+var paramConstraints = map[string]string{
+	"int":   `[0-9]+`,
+	"alpha": `[a-zA-Z]+`,
+	"alnum": `[a-zA-Z0-9]+`,
+	"uuid":  `[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`,
+}
+
 type Node struct {
 	Path     string
 	NodeType NodeType
 	Channel  *Router
 	Children []*Node
+
+	paramName  string
+	constraint *regexp.Regexp
 }
 
 func NewTree() *Node {
@@ -35,8 +60,48 @@ func NewNode(key string, nodeType NodeType) *Node {
 	}
 }
 
-// TODO: Add case for duplicate keys
-func (n *Node) Add(key string, mc *Router) {
+// Adds a channel pattern to the tree. Patterns are made of `.` separated
+// segments which can be static or a param:
+//
+//	{id}          captures a single segment
+//	{id:int}      captures a single segment matching a named constraint
+//	{slug:[a-z]+} captures a single segment matching a regular expression
+//	{path...}     captures the rest of the path. Must be the last segment
+//	{page?}       optional last segment
+//
+// Returns an error if the pattern is already registered or if a param
+// conflicts with a param registered at the same position, e.g. `chat.{id}`
+// and `chat.{roomId}.users`. Params with different constraints do not
+// conflict.
+func (n *Node) Add(key string, mc *Router) error {
+	pattern := key
+
+	if err := validatePattern(pattern); err != nil {
+		return err
+	}
+
+	base, full, ok := expandOptional(key)
+
+	if !ok {
+		return n.addRoute(pattern, key, mc, false)
+	}
+
+	// Both routes are checked first so a failure does not leave one of them
+	// registered
+	for _, route := range []string{base, full} {
+		if err := n.addRoute(pattern, route, mc, true); err != nil {
+			return err
+		}
+	}
+
+	n.addRoute(pattern, base, mc, false)
+
+	return n.addRoute(pattern, full, mc, false)
+}
+
+// Walks the tree to insert key. A dry run returns the same errors without
+// changing the tree.
+func (n *Node) addRoute(pattern string, key string, mc *Router, dryRun bool) error {
 	root := n
 
 walk:
@@ -52,6 +117,12 @@ walk:
 		   * sets this to "tes"
 		*/
 		if i < len(root.Path) {
+			// The new key ends or branches off at the split so it can not
+			// clash with anything registered
+			if dryRun {
+				return nil
+			}
+
 			originalPath := root.Path
 
 			newRootPath := originalPath[:i]
@@ -66,92 +137,191 @@ walk:
 			root.Children = []*Node{node}
 		}
 
+		// Key ends on this node
+		if len(key) == i {
+			if root.Channel != nil {
+				return fmt.Errorf("%w: %q", ErrDuplicateRoute, pattern)
+			}
+
+			if !dryRun {
+				root.Channel = mc
+			}
+
+			return nil
+		}
+
 		// If new key matches this path but is longer add as child
-		if len(key) > i {
-			key = key[i:]
+		key = key[i:]
 
-			if root.IsLeaf() {
+		if root.IsLeaf() {
+			if !dryRun {
 				root.add(key, mc)
-				return
 			}
 
-			if root.IsParam() {
-				root = root.Children[0]
-				continue walk
-			}
+			return nil
+		}
+
+		// Params only share a node when they are exactly the same
+		if key[0] == '{' {
+			_, _, param := getParam(key)
+			paramNode := newParamNode(param)
 
 			for _, ch := range root.Children {
-				if ch.Path[0] == key[0] {
+				if ch.IsStatic() {
+					continue
+				}
+
+				if ch.Path == param {
 					root = ch
 					continue walk
 				}
+
+				if ch.conflicts(paramNode) {
+					return fmt.Errorf("%w: param %s in %q conflicts with %s", ErrConflictingRoute, param, pattern, ch.Path)
+				}
 			}
 
+			if !dryRun {
+				root.add(key, mc)
+			}
+
+			return nil
+		}
+
+		for _, ch := range root.Children {
+			if ch.IsStatic() && ch.Path[0] == key[0] {
+				root = ch
+				continue walk
+			}
+		}
+
+		if !dryRun {
 			root.add(key, mc)
+		}
 
-			return
+		return nil
+	}
+}
+
+// Two params at the same position conflict when they would match the same
+// segments but capture them under different names
+func (n *Node) conflicts(other *Node) bool {
+	if n.NodeType != other.NodeType || n.Path == other.Path {
+		return false
+	}
+
+	return n.constraintString() == other.constraintString()
+}
+
+func (n *Node) constraintString() string {
+	if n.constraint == nil {
+		return ""
+	}
+
+	return n.constraint.String()
+}
+
+// Children are kept sorted by priority so lookups try static segments first,
+// then constrained params, then params and finally catch-alls
+func (n *Node) priority() int {
+	switch n.NodeType {
+	case StaticNode:
+		return 0
+	case ParamNode:
+		if n.constraint != nil {
+			return 1
 		}
+
+		return 2
+	default:
+		return 3
 	}
 }
 
+// Finds the router registered for key. Children are tried in priority order
+// and lookups backtrack when a branch does not lead to a router, so
+// `chat.{id}.users` still matches `chat.admin.users` when `chat.admin.settings`
+// is also registered.
 func (n *Node) Lookup(key string) (root *Node, params *Params) {
-	root = n
+	params = &Params{}
 
-walk:
-	for {
-		if root.IsParam() {
-			end := 0
+	root = n.lookup(key, params)
 
-			for end < len(key) && key[end] != '.' {
-				end++
-			}
+	if root == nil {
+		return nil, nil
+	}
 
-			val := key[:end]
-			key = key[end:]
+	if len(*params) == 0 {
+		return root, nil
+	}
 
-			if params == nil {
-				params = &Params{}
-			}
+	return root, params
+}
 
-			params.Add(root.getParamName(), val)
-		} else {
-			i := findLongestCommonPrefix(root.Path, key)
+func (n *Node) lookup(key string, params *Params) *Node {
+	switch n.NodeType {
+	case CatchAllNode:
+		if len(key) == 0 || n.Channel == nil {
+			return nil
+		}
 
-			if i < len(root.Path) {
-				return nil, nil
-			}
+		params.Add(n.getParamName(), key)
 
-			if i == len(key) {
-				return root, params
-			}
+		return n
+
+	case ParamNode:
+		end := segmentEnd(key)
+		val := UnescapeSegment(key[:end])
 
-			key = key[i:]
+		if len(val) == 0 || (n.constraint != nil && !n.constraint.MatchString(val)) {
+			return nil
 		}
 
-		// I think we need this.
-		// If key is used up and we aren't on a leaf
-		// we shouldn't continue
-		if len(key) == 0 {
-			return root, params
+		params.Add(n.getParamName(), val)
+		key = key[end:]
+
+	default:
+		if !strings.HasPrefix(key, n.Path) {
+			return nil
 		}
 
-		for _, child := range root.Children {
-			if child.IsParam() {
-				root = child
-				continue walk
+		key = key[len(n.Path):]
+	}
+
+	if len(key) == 0 {
+		if n.Channel != nil {
+			return n
+		}
+	} else {
+		for _, child := range n.Children {
+			if child.IsStatic() && child.Path[0] != key[0] {
+				continue
 			}
 
-			if child.Path[0] == key[0] {
-				root = child
-				continue walk
+			if match := child.lookup(key, params); match != nil {
+				return match
 			}
 		}
+	}
+
+	// Nothing matched down this branch so drop this node's param and let the
+	// caller try the next sibling
+	if n.IsParam() {
+		params.pop()
+	}
+
+	return nil
+}
 
-		// If we have gotten this far then there is not match in any of the children
-		break walk
+// Index of the end of the first segment in key
+func segmentEnd(key string) int {
+	end := strings.IndexByte(key, '.')
+
+	if end < 0 {
+		return len(key)
 	}
 
-	return nil, nil
+	return end
 }
 
 func (n *Node) EmptyPath() bool {
@@ -170,35 +340,147 @@ func (n *Node) IsLeaf() bool {
 	return false
 }
 
+// Finds the first param in path returning its start and end index and the
+// param including its braces. End is -1 if the param is never closed. Braces
+// can be nested inside a param to allow regular expressions such as
+// `{code:[a-z]{3}}`.
 func getParam(path string) (start int, end int, paramName string) {
-	paramName = ""
+	start = strings.IndexByte(path, '{')
 
-	for start, c := range []byte(path) {
-		if c != '{' {
-			continue
-		}
+	if start < 0 {
+		return -1, -1, ""
+	}
+
+	depth := 0
 
-		paramName = paramName + "{"
+	for i := start; i < len(path); i++ {
+		switch path[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
 
-		for end, c := range []byte(path[start+1:]) {
-			if c == '}' {
-				paramName = paramName + "}"
-				return start, start + end + 2, paramName
+			if depth == 0 {
+				return start, i + 1, path[start : i+1]
 			}
+		}
+	}
+
+	return start, -1, ""
+}
+
+// Creates a param or catch-all node from a param including its braces
+func newParamNode(param string) *Node {
+	name := param[1 : len(param)-1]
 
-			paramName = paramName + string(c)
+	if isCatchAllParam(param) {
+		return &Node{
+			Path:      param,
+			NodeType:  CatchAllNode,
+			paramName: strings.TrimSuffix(name, "..."),
 		}
 	}
 
-	return -1, -1, paramName
+	node := &Node{
+		Path:      param,
+		NodeType:  ParamNode,
+		paramName: name,
+	}
+
+	name, constraint, hasConstraint := strings.Cut(name, ":")
+
+	if !hasConstraint {
+		return node
+	}
+
+	node.paramName = name
+	node.constraint, _ = compileConstraint(constraint)
+
+	return node
+}
+
+func compileConstraint(constraint string) (*regexp.Regexp, error) {
+	if named, ok := paramConstraints[constraint]; ok {
+		constraint = named
+	}
+
+	return regexp.Compile("^(?:" + constraint + ")$")
+}
+
+func isCatchAllParam(param string) bool {
+	return strings.HasSuffix(param, "...}")
+}
+
+// Optional params can not have a constraint so that `?` is never confused
+// with a regular expression
+func isOptionalParam(param string) bool {
+	return strings.HasSuffix(param, "?}") && !strings.Contains(param, ":")
+}
+
+// Checks params are closed, constraints compile and that catch-all or
+// optional params are only used at the end of a pattern
+func validatePattern(pattern string) error {
+	key := pattern
+
+	for {
+		start, end, param := getParam(key)
+
+		if start < 0 {
+			return nil
+		}
+
+		if end < 0 {
+			return fmt.Errorf("%w: unclosed param in %q", ErrInvalidRoute, pattern)
+		}
+
+		last := end == len(key)
+
+		if isCatchAllParam(param) && !last {
+			return fmt.Errorf("%w: catch-all param %s must be the last segment of %q", ErrInvalidRoute, param, pattern)
+		}
+
+		if isOptionalParam(param) && !last {
+			return fmt.Errorf("%w: optional param %s must be the last segment of %q", ErrInvalidRoute, param, pattern)
+		}
+
+		if _, constraint, ok := strings.Cut(param[1:len(param)-1], ":"); ok {
+			if _, err := compileConstraint(constraint); err != nil {
+				return fmt.Errorf("%w: param %s in %q: %s", ErrInvalidRoute, param, pattern, err)
+			}
+		}
+
+		key = key[end:]
+	}
+}
+
+// If pattern ends in an optional param, returns the pattern without the
+// segment and the pattern with the param made required
+//
+//	doc.{id}.{page?} -> doc.{id}, doc.{id}.{page}
+func expandOptional(pattern string) (base string, full string, ok bool) {
+	if !strings.HasSuffix(pattern, "}") {
+		return "", "", false
+	}
+
+	start := strings.LastIndexByte(pattern, '{')
+	param := pattern[start:]
+
+	if !isOptionalParam(param) {
+		return "", "", false
+	}
+
+	base = strings.TrimSuffix(pattern[:start], ".")
+	full = pattern[:len(pattern)-2] + "}"
+
+	return base, full, true
 }
 
 func (n *Node) getParamName() string {
-	if !n.IsParam() {
+	if n.IsStatic() {
 		return ""
 	}
 
-	return n.Path[1 : len(n.Path)-1]
+	return n.paramName
 }
 
 func (n *Node) add(path string, mc *Router) {
@@ -226,10 +508,7 @@ func (n *Node) add(path string, mc *Router) {
 		}
 
 		if start == 0 {
-			paramNode := &Node{
-				Path:     param,
-				NodeType: ParamNode,
-			}
+			paramNode := newParamNode(param)
 
 			root.addNode(paramNode)
 
@@ -257,7 +536,13 @@ func (n *Node) add(path string, mc *Router) {
 func (n *Node) addNode(node *Node) {
 	n.ensureChildren()
 
-	n.Children = append(n.Children, node)
+	i := len(n.Children)
+
+	for i > 0 && n.Children[i-1].priority() > node.priority() {
+		i--
+	}
+
+	n.Children = slices.Insert(n.Children, i, node)
 }
 
 func (n *Node) ensureChildren() {
@@ -276,6 +561,36 @@ func (n *Node) IsParam() bool {
 	return n.NodeType == ParamNode
 }
 
+func (n *Node) IsCatchAll() bool {
+	return n.NodeType == CatchAllNode
+}
+
+// Every router in the tree. Routers registered with an optional param appear
+// once even though they are stored under two nodes.
+func (n *Node) Routers() []*Router {
+	seen := make(map[*Router]bool)
+	routers := []*Router{}
+
+	n.walk(func(node *Node) {
+		if node.Channel == nil || seen[node.Channel] {
+			return
+		}
+
+		seen[node.Channel] = true
+		routers = append(routers, node.Channel)
+	})
+
+	return routers
+}
+
+func (n *Node) walk(fn func(*Node)) {
+	fn(n)
+
+	for _, child := range n.Children {
+		child.walk(fn)
+	}
+}
+
 func (n *Node) Print() {
 	str, _ := json.MarshalIndent(n, "", "  ")
 
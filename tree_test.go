@@ -1,7 +1,9 @@
 package gosock
 
 import (
+	"errors"
 	"log"
+	"strings"
 	"testing"
 	"time"
 )
@@ -196,3 +198,216 @@ func BenchmarkLookupWithParams(b *testing.B) {
 		tree.Lookup("test.test.123.two.456.two")
 	}
 }
+
+func TestLookupCatchAll(t *testing.T) {
+	tree := NewTree()
+	router := NewRouter("files", makeHub())
+
+	tree.Add("files.{path...}", router)
+
+	match, params := tree.Lookup("files.docs.2023.report.pdf")
+
+	if match == nil || match.Channel == nil {
+		t.Fatalf("Should have found match for catch-all")
+	}
+
+	path, _ := params.Get("path")
+
+	if path != "docs.2023.report.pdf" {
+		t.Errorf("Catch-all should capture the rest of the path. Got %s", path)
+	}
+
+	if noMatch, _ := tree.Lookup("files."); noMatch != nil && noMatch.Channel != nil {
+		t.Errorf("Catch-all should not match an empty path")
+	}
+}
+
+func TestLookupOptional(t *testing.T) {
+	tree := NewTree()
+	router := NewRouter("doc", makeHub())
+
+	tree.Add("doc.{id}.{page?}", router)
+
+	tests := []struct {
+		path    string
+		page    string
+		hasPage bool
+	}{
+		{"doc.42", "", false},
+		{"doc.42.7", "7", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			match, params := tree.Lookup(tt.path)
+
+			if match == nil || match.Channel == nil {
+				t.Fatalf("Should have found match %s", tt.path)
+			}
+
+			page, ok := params.Get("page")
+
+			if ok != tt.hasPage || page != tt.page {
+				t.Errorf("Page should be %q (%v). Got %q (%v)", tt.page, tt.hasPage, page, ok)
+			}
+		})
+	}
+}
+
+func TestLookupConstraints(t *testing.T) {
+	tree := NewTree()
+
+	tree.Add("doc.{id:int}.section.{section:int}.para.{para:int}", NewRouter("para", makeHub()))
+	tree.Add("user.{slug:[a-z-]+}", NewRouter("user", makeHub()))
+	tree.Add("code.{code:[A-Z]{3}}", NewRouter("code", makeHub()))
+
+	tests := []struct {
+		path  string
+		match bool
+	}{
+		{"doc.42.section.7.para.3", true},
+		{"doc.abc.section.7.para.3", false},
+		{"doc.42.section.7.para.x", false},
+		{"user.some-user", true},
+		{"user.Some_User", false},
+		{"code.ABC", true},
+		{"code.ABCD", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			match, _ := tree.Lookup(tt.path)
+
+			if (match != nil && match.Channel != nil) != tt.match {
+				t.Errorf("Match for %s should be %v", tt.path, tt.match)
+			}
+		})
+	}
+
+	_, params := tree.Lookup("doc.42.section.7.para.3")
+
+	if id, _ := params.Get("id"); id != "42" {
+		t.Errorf("Constrained param name should not include constraint. Got id=%q", id)
+	}
+}
+
+func TestLookupConstrainedSiblings(t *testing.T) {
+	tree := NewTree()
+
+	numeric := NewRouter("numeric", makeHub())
+	slug := NewRouter("slug", makeHub())
+
+	tree.Add("item.{id:int}", numeric)
+	tree.Add("item.{slug}", slug)
+
+	if match, _ := tree.Lookup("item.12"); match == nil || match.Channel != numeric {
+		t.Errorf("Numeric item should match int constraint")
+	}
+
+	if match, _ := tree.Lookup("item.abc"); match == nil || match.Channel != slug {
+		t.Errorf("Non numeric item should fall through to unconstrained param")
+	}
+}
+
+func TestAddConflicts(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing string
+		pattern  string
+		err      error
+	}{
+		{"duplicate", "chat.{id}", "chat.{id}", ErrDuplicateRoute},
+		{"duplicate static", "chat.lobby", "chat.lobby", ErrDuplicateRoute},
+		{"optional duplicate", "doc.{id}", "doc.{id}.{page?}", ErrDuplicateRoute},
+		{"param name", "chat.{id}", "chat.{roomId}.users", ErrConflictingRoute},
+		{"catch-all name", "files.{path...}", "files.{rest...}", ErrConflictingRoute},
+		{"unclosed", "chat", "chat.{id", ErrInvalidRoute},
+		{"catch-all not last", "chat", "files.{path...}.meta", ErrInvalidRoute},
+		{"bad regex", "chat", "user.{slug:[a-z}", ErrInvalidRoute},
+		{"different constraint", "item.{id:int}", "item.{slug}", nil},
+		{"param and catch-all", "files.{name}", "files.{path...}", nil},
+		{"static and param", "chat.{id}", "chat.lobby", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree := NewTree()
+			router := NewRouter("test", makeHub())
+
+			if err := tree.Add(tt.existing, router); err != nil {
+				t.Fatalf("Adding %s should not fail: %s", tt.existing, err)
+			}
+
+			err := tree.Add(tt.pattern, router)
+
+			if !errors.Is(err, tt.err) {
+				t.Errorf("Adding %s after %s should return %v. Got %v", tt.pattern, tt.existing, tt.err, err)
+			}
+		})
+	}
+}
+
+func TestAddOptionalIsAtomic(t *testing.T) {
+	tree := NewTree()
+	router := NewRouter("test", makeHub())
+
+	if err := tree.Add("doc.{id}.{x}.more", router); err != nil {
+		t.Fatalf("Adding doc.{id}.{x}.more should not fail: %s", err)
+	}
+
+	// The base route is free but the full route conflicts
+	if err := tree.Add("doc.{id}.{page?}", router); !errors.Is(err, ErrConflictingRoute) {
+		t.Fatalf("Expected %v. Got %v", ErrConflictingRoute, err)
+	}
+
+	if match, _ := tree.Lookup("doc.1"); match != nil && match.Channel != nil {
+		t.Errorf("Base route should not be registered when the full route fails")
+	}
+
+	if err := tree.Add("doc.{id}", router); err != nil {
+		t.Errorf("Base route should still be free. Got %s", err)
+	}
+}
+
+func TestLookupPriority(t *testing.T) {
+	tree := NewTree()
+
+	static := NewRouter("static", makeHub())
+	param := NewRouter("param", makeHub())
+	catchAll := NewRouter("catchAll", makeHub())
+
+	// Registered lowest priority first to make sure order does not matter
+	tree.Add("chat.{rest...}", catchAll)
+	tree.Add("chat.{id}.users", param)
+	tree.Add("chat.admin.settings", static)
+
+	tests := []struct {
+		path string
+		want *Router
+	}{
+		{"chat.admin.settings", static},
+		{"chat.admin.users", param},
+		{"chat.123.users", param},
+		{"chat.admin.other", catchAll},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			match, params := tree.Lookup(tt.path)
+
+			if match == nil || match.Channel != tt.want {
+				t.Fatalf("%s should match %s router", tt.path, tt.want.path)
+			}
+
+			if tt.want == param {
+				if id, _ := params.Get("id"); id != strings.Split(tt.path, ".")[1] {
+					t.Errorf("Backtracking should leave correct params. Got id=%s", id)
+				}
+			}
+
+			if tt.want == static && params != nil {
+				t.Errorf("Static match should not have params. Got %d", len(*params))
+			}
+		})
+	}
+}